@@ -0,0 +1,54 @@
+/*
+Copyright © 2022 Christian Hernandez christian@chernand.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/christianh814/bekind/pkg/addons"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// checkUpdatesCmd represents the checkupdates command
+var checkUpdatesCmd = &cobra.Command{
+	Use:     "checkupdates",
+	Aliases: []string{"check-updates", "outdated"},
+	Short:   "Reports add-ons with newer versions upstream",
+	Long: `Checks the add-ons pinned under "addons" in the config file
+against their upstream (GitHub releases, Helm repo or OCI registry) and
+prints the ones with a newer stable version. Nothing is bumped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var catalog addons.Catalog
+		if err := viper.UnmarshalKey("addons", &catalog); err != nil {
+			log.Fatal(err)
+		}
+
+		updates, err := addons.CheckAddonUpdates(context.TODO(), catalog)
+		if err != nil {
+			log.Warn(err)
+		}
+		for _, u := range updates {
+			fmt.Println(u)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkUpdatesCmd)
+}
@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"github.com/christianh814/bekind/pkg/kind"
+	"github.com/christianh814/bekind/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -36,7 +37,7 @@ if one isn't named.`,
 			log.Fatal(err)
 		}
 		log.Info("Destroying KIND cluster")
-		if err := kind.DeleteKindCluster(clusterName, ""); err != nil {
+		if err := kind.DeleteKindCluster(clusterName, "", utils.DestructiveTeardown); err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -21,8 +21,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/christianh814/bekind/pkg/cluster"
 	"github.com/christianh814/bekind/pkg/helm"
 	"github.com/christianh814/bekind/pkg/kind"
+	"github.com/christianh814/bekind/pkg/testsvc"
 	"github.com/christianh814/bekind/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -63,6 +65,9 @@ it installs Argo CD and an HAProxy Ingress controller.`,
 		if err != nil {
 			log.Fatal(err)
 		}
+		if err := utils.ValidateClusterName(clusterName); err != nil {
+			log.Fatal(err)
+		}
 
 		// Get clulster type from CLI
 		var clusterType string
@@ -90,6 +95,27 @@ it installs Argo CD and an HAProxy Ingress controller.`,
 			clusterType = "full"
 		}
 
+		// Build the kind config from the presets in the config file, unless a kindConfig was given
+		localRegistry := false
+		if presets := viper.GetStringSlice("presets"); len(presets) != 0 && viper.GetString("kindConfig") == "" {
+			opts, err := kind.ComposePresets(presets...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			// ingress-nginx is always installed, and it only runs on the node the ingress preset labels
+			ingress := true
+			if err := opts.Merge(kind.ClusterOptions{Ingress: &ingress}); err != nil {
+				log.Fatalf("Presets can't turn off ingress, bekind start always installs ingress-nginx: %v", err)
+			}
+			presetConfig, err := opts.KindConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			viper.Set("kindConfig", presetConfig)
+			localRegistry = opts.LocalRegistry != nil && *opts.LocalRegistry
+			log.Warnf("Using kind presets %v", presets)
+		}
+
 		// Get the custom kind config from the config file
 		kindConfig := viper.GetString("kindConfig")
 		if kindConfig != "" {
@@ -115,12 +141,41 @@ it installs Argo CD and an HAProxy Ingress controller.`,
 			log.Fatal(err)
 		}
 
+		// Do we verify the cluster with the test services? Get from CLI
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			log.Fatal(err)
+		}
+		verifyImage, err := cmd.Flags().GetString("verify-image")
+		if err != nil {
+			log.Fatal(err)
+		}
+		verify = verify || verifyImage != ""
+
+		// Make sure the test services image can be built before creating anything
+		if verify && verifyImage == "" {
+			if err := testsvc.CanBuildImage(); err != nil {
+				log.Fatalf("Can't run --verify with this bekind binary, pass --verify-image: %v", err)
+			}
+		}
+
 		// Try and start the kind cluster
 		err = kind.CreateKindCluster(clusterName, clusterType, KindImageVersion)
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		// Wire up the local registry if the presets asked for one
+		if localRegistry {
+			log.Info("Connecting local registry")
+			if err := cluster.EnsureLocalRegistry(cluster.DefaultRegistryName, cluster.DefaultRegistryPort); err != nil {
+				log.Fatal(err)
+			}
+			if err := cluster.ConnectRegistryToCluster(clusterName, cluster.DefaultRegistryName); err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		// Get the client from the new Kubernetes clusters
 		client, err := utils.NewClient("")
 		if err != nil {
@@ -262,6 +317,61 @@ it installs Argo CD and an HAProxy Ingress controller.`,
 			//
 		}
 
+		// Run any readiness probes from the config file, after everything else is installed
+		var probes []utils.Probe
+		if err := viper.UnmarshalKey("probes", &probes); err != nil {
+			log.Fatal(err)
+		}
+		if len(probes) != 0 {
+			log.Info("Running readiness probes from config file")
+			restConfig, err := utils.NewConfig("")
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			failed := false
+			for _, r := range utils.RunProbes(context.TODO(), restConfig, probes) {
+				if r.Passed {
+					log.Infof("Probe %q passed after %d attempt(s)", r.Name, r.Attempts)
+					continue
+				}
+				failed = true
+				log.Errorf("Probe %q failed after %d attempt(s): %v\n%s", r.Name, r.Attempts, r.Err, r.Output)
+			}
+			if failed {
+				log.Fatal("Readiness probes failed")
+			}
+		}
+
+		// Check DNS and connectivity with the built-in test services if asked
+		if verify {
+			log.Info("Verifying cluster DNS and connectivity")
+			restConfig, err := utils.NewConfig("")
+			if err != nil {
+				log.Fatal(err)
+			}
+			verifyOpts := []testsvc.Option{testsvc.WithClusterName(clusterName)}
+			if verifyImage != "" {
+				verifyOpts = append(verifyOpts, testsvc.WithImage(verifyImage))
+			}
+			results, err := testsvc.Verify(context.TODO(), restConfig, verifyOpts...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			failed := false
+			for _, r := range results {
+				if r.Passed {
+					log.Infof("Check %q passed after %d attempt(s)", r.Name, r.Attempts)
+					continue
+				}
+				failed = true
+				log.Errorf("Check %q failed after %d attempt(s): %v\n%s", r.Name, r.Attempts, r.Err, r.Output)
+			}
+			if failed {
+				log.Fatal("Cluster verification failed")
+			}
+		}
+
 		//
 		log.Infof("Argo CD is available at %s username: admin password %s", argoUrl, argoPass)
 	},
@@ -278,6 +388,8 @@ func init() {
 	// startCmd.PersistentFlags().String("foo", "", "A help for foo")
 	startCmd.PersistentFlags().Bool("single", false, "Install a single instance of the kind cluster")
 	startCmd.PersistentFlags().Bool("argocd", true, "Install Argo CD")
+	startCmd.PersistentFlags().Bool("verify", false, "Check cluster DNS and connectivity with the built-in test services")
+	startCmd.PersistentFlags().String("verify-image", "", "Image with bekind as /bekind to run the test services from, instead of one built from this binary (implies --verify)")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 Christian Hernandez christian@chernand.io
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/testsvc"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// testsvcCmd is what the test services images run, it's not meant to be used directly
+var testsvcCmd = &cobra.Command{
+	Use:    "testsvc",
+	Short:  "Runs the in-cluster test services",
+	Hidden: true,
+}
+
+var testsvcEchoCmd = &cobra.Command{
+	Use:   "echo",
+	Short: "Runs the echo HTTP server",
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if err := testsvc.ServeEcho(ctx, fmt.Sprintf(":%d", port)); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var testsvcSleepCmd = &cobra.Command{
+	Use:   "sleep",
+	Short: "Waits to be stopped, so checks can be exec'd in the pod",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+	},
+}
+
+var testsvcDNSCmd = &cobra.Command{
+	Use:   "dns NAME",
+	Short: "Resolves the name",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		addrs, err := testsvc.LookupHost(ctx, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(strings.Join(addrs, "\n"))
+	},
+}
+
+var testsvcHTTPCmd = &cobra.Command{
+	Use:   "http URL",
+	Short: "Does a GET of the URL, failing on anything but a 2xx",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		body, err := testsvc.CheckHTTP(ctx, args[0])
+		fmt.Print(body)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var testsvcTCPCmd = &cobra.Command{
+	Use:   "tcp HOST:PORT",
+	Short: "Opens a TCP connection to the address",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := testsvc.CheckTCP(ctx, args[0]); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testsvcCmd)
+	testsvcCmd.AddCommand(testsvcEchoCmd, testsvcSleepCmd, testsvcDNSCmd, testsvcHTTPCmd, testsvcTCPCmd)
+
+	testsvcEchoCmd.Flags().Int("port", 8080, "The port to listen on")
+}
@@ -0,0 +1,437 @@
+package addons
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/christianh814/bekind/pkg/utils"
+	"golang.org/x/time/rate"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// GitHubTokenEnv is the environment variable holding the token used for the GitHub API
+var GitHubTokenEnv string = "GITHUB_TOKEN"
+
+// GitHubAPI is the base URL of the GitHub API
+var GitHubAPI string = "https://api.github.com"
+
+// DefaultCacheTTL is how long an upstream answer is reused before asking again
+var DefaultCacheTTL time.Duration = time.Hour
+
+// DefaultRateLimit is how often upstream queries are allowed to go out
+var DefaultRateLimit rate.Limit = rate.Every(time.Second)
+
+// cacheFile is the name of the cache file in Checker.CacheDir
+const cacheFile = "cache.json"
+
+// Addon is a pinned add-on and where to look for newer versions of it.
+// Only one of GitHub, HelmRepo or OCI is expected to be set
+type Addon struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// GitHub is the "owner/repo" whose releases are checked
+	GitHub string `json:"github,omitempty"`
+	// HelmRepo is the URL of the Helm repository that has Chart
+	HelmRepo string `json:"helmRepo,omitempty"`
+	Chart    string `json:"chart,omitempty"`
+	// OCI is the oci:// reference of the chart, without a tag
+	OCI string `json:"oci,omitempty"`
+}
+
+// Catalog is the list of add-ons to check
+type Catalog []Addon
+
+// UpdateInfo is an add-on with a newer stable version upstream
+type UpdateInfo struct {
+	Name    string
+	Current string
+	Latest  string
+	// URL is where the latest release can be found
+	URL string
+	// Source is the upstream that was checked
+	Source string
+}
+
+func (u UpdateInfo) String() string {
+	return fmt.Sprintf("%s: %s -> %s (%s)", u.Name, u.Current, u.Latest, u.URL)
+}
+
+// release is the latest stable version upstream
+type release struct {
+	version *semver.Version
+	url     string
+}
+
+// cacheEntry is an upstream answer as it's kept in the cache file
+type cacheEntry struct {
+	Version string    `json:"version"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// Checker queries the upstreams of a Catalog, rate limiting and caching what it asks
+type Checker struct {
+	// HTTPClient is used for the GitHub and Helm repo queries, http.DefaultClient is used if nil
+	HTTPClient *http.Client
+	// CacheTTL is how long answers are cached, DefaultCacheTTL is used if 0
+	CacheTTL time.Duration
+	// CacheDir is where answers are kept between runs, they're only kept in memory if it's empty
+	CacheDir string
+
+	limiter *rate.Limiter
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+	loaded  bool
+}
+
+// NewChecker returns a Checker allowing the given number of upstream queries per second
+func NewChecker(limit rate.Limit) *Checker {
+	return &Checker{
+		limiter: rate.NewLimiter(limit, 1),
+		cache:   map[string]cacheEntry{},
+	}
+}
+
+// DefaultCacheDir returns where CheckAddonUpdates keeps its cache, under the user's cache directory
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bekind", "addons")
+}
+
+var (
+	defaultCheckerOnce sync.Once
+	defaultChecker     *Checker
+)
+
+// CheckAddonUpdates reports the add-ons in the catalog that have a newer stable version upstream.
+// Answers are cached in DefaultCacheDir for DefaultCacheTTL
+func CheckAddonUpdates(ctx context.Context, catalog Catalog) ([]UpdateInfo, error) {
+	defaultCheckerOnce.Do(func() {
+		defaultChecker = NewChecker(DefaultRateLimit)
+		defaultChecker.CacheDir = DefaultCacheDir()
+	})
+	return defaultChecker.Check(ctx, catalog)
+}
+
+// Check reports the add-ons in the catalog that have a newer stable version upstream. Entries
+// that can't be checked are skipped and their errors returned together with the updates found
+func (c *Checker) Check(ctx context.Context, catalog Catalog) ([]UpdateInfo, error) {
+	var updates []UpdateInfo
+	var errs []error
+	for _, a := range catalog {
+		u, err := c.checkAddon(ctx, a)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.Name, err))
+			continue
+		}
+		if u != nil {
+			updates = append(updates, *u)
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// checkAddon returns an UpdateInfo if there's something newer than the pin, nil if there isn't
+func (c *Checker) checkAddon(ctx context.Context, a Addon) (*UpdateInfo, error) {
+	current, err := semver.NewVersion(a.Version)
+	if err != nil {
+		return nil, fmt.Errorf("pinned version %q: %w", a.Version, err)
+	}
+
+	var source string
+	var latest release
+	switch {
+	case a.GitHub != "":
+		source = "github.com/" + a.GitHub
+		latest, err = c.cached(ctx, "github:"+a.GitHub, func() (release, error) {
+			return c.latestGitHubRelease(ctx, a.GitHub)
+		})
+	case a.HelmRepo != "":
+		source = a.HelmRepo
+		latest, err = c.cached(ctx, "helm:"+a.HelmRepo+"/"+a.Chart, func() (release, error) {
+			return c.latestHelmChart(ctx, a.HelmRepo, a.Chart)
+		})
+	case a.OCI != "":
+		source = a.OCI
+		latest, err = c.cached(ctx, "oci:"+a.OCI, func() (release, error) {
+			return latestOCITag(ctx, a.OCI)
+		})
+	default:
+		// Nothing to check against
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !latest.version.GreaterThan(current) {
+		return nil, nil
+	}
+	return &UpdateInfo{
+		Name:    a.Name,
+		Current: a.Version,
+		Latest:  latest.version.Original(),
+		URL:     latest.url,
+		Source:  source,
+	}, nil
+}
+
+// cached returns the answer for key from the cache, or asks upstream once the rate limit allows
+func (c *Checker) cached(ctx context.Context, key string, query func() (release, error)) (release, error) {
+	c.mu.Lock()
+	c.loadCache()
+	e, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.Expires) {
+		if v, err := semver.NewVersion(e.Version); err == nil {
+			return release{version: v, url: e.URL}, nil
+		}
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return release{}, err
+	}
+	r, err := query()
+	if err != nil {
+		return release{}, err
+	}
+
+	ttl := c.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	c.mu.Lock()
+	c.cache[key] = cacheEntry{Version: r.version.Original(), URL: r.url, Expires: time.Now().Add(ttl)}
+	if err := c.saveCache(); err != nil {
+		utils.GetLogger().Warn("unable to save the add-on update cache", "dir", c.CacheDir, "error", err)
+	}
+	c.mu.Unlock()
+	return r, nil
+}
+
+// loadCache reads the cache file the first time it's needed, c.mu has to be held
+func (c *Checker) loadCache() {
+	if c.loaded || c.CacheDir == "" {
+		return
+	}
+	c.loaded = true
+
+	b, err := os.ReadFile(filepath.Join(c.CacheDir, cacheFile))
+	if err != nil {
+		return
+	}
+	entries := map[string]cacheEntry{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		// A broken cache just means asking upstream again
+		return
+	}
+	for k, e := range entries {
+		if _, ok := c.cache[k]; !ok {
+			c.cache[k] = e
+		}
+	}
+}
+
+// saveCache writes the unexpired entries to the cache file, c.mu has to be held
+func (c *Checker) saveCache() error {
+	if c.CacheDir == "" {
+		return nil
+	}
+
+	entries := map[string]cacheEntry{}
+	for k, e := range c.cache {
+		if time.Now().Before(e.Expires) {
+			entries[k] = e
+		}
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves half a file behind
+	tmp, err := os.CreateTemp(c.CacheDir, cacheFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.CacheDir, cacheFile))
+}
+
+// get fetches the URL, failing on anything but a 200
+func (c *Checker) get(ctx context.Context, u string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestGitHubRelease returns the highest release of owner/repo that isn't a draft or prerelease
+func (c *Checker) latestGitHubRelease(ctx context.Context, ownerRepo string) (release, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv(GitHubTokenEnv); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	b, err := c.get(ctx, fmt.Sprintf("%s/repos/%s/releases?per_page=100", GitHubAPI, ownerRepo), header)
+	if err != nil {
+		return release{}, err
+	}
+
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		HTMLURL    string `json:"html_url"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+	}
+	if err := json.Unmarshal(b, &releases); err != nil {
+		return release{}, err
+	}
+
+	var latest release
+	for _, r := range releases {
+		if r.Draft || r.Prerelease {
+			continue
+		}
+		v, err := semver.NewVersion(r.TagName)
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if latest.version == nil || v.GreaterThan(latest.version) {
+			latest = release{version: v, url: r.HTMLURL}
+		}
+	}
+	if latest.version == nil {
+		return release{}, fmt.Errorf("no stable releases found for %s", ownerRepo)
+	}
+	return latest, nil
+}
+
+// latestHelmChart returns the highest stable version of the chart in the repo's index
+func (c *Checker) latestHelmChart(ctx context.Context, repoURL, chart string) (release, error) {
+	indexURL := strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+	b, err := c.get(ctx, indexURL, nil)
+	if err != nil {
+		return release{}, err
+	}
+
+	index := repo.NewIndexFile()
+	if err := yaml.Unmarshal(b, index); err != nil {
+		return release{}, fmt.Errorf("parsing %s: %w", indexURL, err)
+	}
+	index.SortEntries()
+
+	// An empty version only matches stable releases
+	cv, err := index.Get(chart, "")
+	if err != nil {
+		return release{}, fmt.Errorf("%s in %s: %w", chart, repoURL, err)
+	}
+	v, err := semver.NewVersion(cv.Version)
+	if err != nil {
+		return release{}, err
+	}
+
+	r := release{version: v, url: cv.Home}
+	if len(cv.URLs) != 0 {
+		// Chart URLs can be relative to the repo
+		base, err := url.Parse(indexURL)
+		if err != nil {
+			return release{}, err
+		}
+		ref, err := url.Parse(cv.URLs[0])
+		if err != nil {
+			return release{}, err
+		}
+		r.url = base.ResolveReference(ref).String()
+	}
+	return r, nil
+}
+
+// latestOCITag returns the highest stable semver tag of the oci:// reference. The
+// credentials from "helm registry login" are used for private registries
+func latestOCITag(ctx context.Context, ref string) (release, error) {
+	client, err := registry.NewClient(registry.ClientOptCredentialsFile(cli.New().RegistryConfig))
+	if err != nil {
+		return release{}, err
+	}
+
+	// The registry client doesn't take a context, so stop waiting for it once ctx is done
+	ref = strings.TrimPrefix(ref, registry.OCIScheme+"://")
+	type result struct {
+		tags []string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		tags, err := client.Tags(ref)
+		done <- result{tags: tags, err: err}
+	}()
+
+	var tags []string
+	select {
+	case <-ctx.Done():
+		return release{}, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return release{}, r.err
+		}
+		tags = r.tags
+	}
+
+	// Tags come back highest first
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		return release{version: v, url: fmt.Sprintf("%s://%s:%s", registry.OCIScheme, ref, t)}, nil
+	}
+	return release{}, fmt.Errorf("no stable tags found for %s", ref)
+}
@@ -0,0 +1,178 @@
+package addons
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// upstream serves a GitHub releases list for owner/repo and a Helm repo index, counting the requests
+func upstream(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases":
+			if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+				t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+			}
+			fmt.Fprint(w, `[
+				{"tag_name": "v3.0.0", "html_url": "https://example.com/draft", "draft": true},
+				{"tag_name": "v2.1.0-rc.1", "html_url": "https://example.com/rc", "prerelease": true},
+				{"tag_name": "v2.0.0-beta.1", "html_url": "https://example.com/beta"},
+				{"tag_name": "v1.5.0", "html_url": "https://example.com/v1.5.0"},
+				{"tag_name": "v1.4.0", "html_url": "https://example.com/v1.4.0"},
+				{"tag_name": "nightly", "html_url": "https://example.com/nightly"}
+			]`)
+		case "/charts/index.yaml":
+			fmt.Fprint(w, `apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 2.0.0-alpha.1
+    urls: [mychart-2.0.0-alpha.1.tgz]
+  - name: mychart
+    version: 1.10.0
+    urls: [mychart-1.10.0.tgz]
+  - name: mychart
+    version: 1.9.0
+    urls: [https://cdn.example.com/mychart-1.9.0.tgz]
+`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv(GitHubTokenEnv, "secret")
+
+	api := GitHubAPI
+	GitHubAPI = srv.URL
+	t.Cleanup(func() { GitHubAPI = api })
+
+	return srv, &requests
+}
+
+func TestCheck(t *testing.T) {
+	srv, _ := upstream(t)
+
+	tests := []struct {
+		name  string
+		addon Addon
+		want  *UpdateInfo
+	}{
+		{
+			name:  "github skips drafts and prereleases",
+			addon: Addon{Name: "gh", Version: "v1.4.0", GitHub: "owner/repo"},
+			want: &UpdateInfo{
+				Name: "gh", Current: "v1.4.0", Latest: "v1.5.0",
+				URL: "https://example.com/v1.5.0", Source: "github.com/owner/repo",
+			},
+		},
+		{
+			name:  "github pinned to latest",
+			addon: Addon{Name: "gh", Version: "1.5.0", GitHub: "owner/repo"},
+		},
+		{
+			name:  "helm index",
+			addon: Addon{Name: "chart", Version: "1.9.0", HelmRepo: srv.URL + "/charts", Chart: "mychart"},
+			want: &UpdateInfo{
+				Name: "chart", Current: "1.9.0", Latest: "1.10.0",
+				URL: srv.URL + "/charts/mychart-1.10.0.tgz", Source: srv.URL + "/charts",
+			},
+		},
+		{
+			name:  "helm pinned to latest",
+			addon: Addon{Name: "chart", Version: "1.10.0", HelmRepo: srv.URL + "/charts", Chart: "mychart"},
+		},
+		{
+			name:  "no upstream",
+			addon: Addon{Name: "local", Version: "1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := NewChecker(rate.Inf).Check(context.Background(), Catalog{tt.addon})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == nil {
+				if len(updates) != 0 {
+					t.Fatalf("expected no updates, got %v", updates)
+				}
+				return
+			}
+			if len(updates) != 1 || updates[0] != *tt.want {
+				t.Fatalf("got %+v, want %+v", updates, *tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	srv, _ := upstream(t)
+
+	catalog := Catalog{
+		{Name: "bad-pin", Version: "latest", GitHub: "owner/repo"},
+		{Name: "missing", Version: "1.0.0", GitHub: "owner/missing"},
+		{Name: "no-chart", Version: "1.0.0", HelmRepo: srv.URL + "/charts", Chart: "other"},
+		{Name: "gh", Version: "v1.4.0", GitHub: "owner/repo"},
+	}
+	updates, err := NewChecker(rate.Inf).Check(context.Background(), catalog)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(updates) != 1 || updates[0].Name != "gh" {
+		t.Fatalf("expected the gh update despite the errors, got %v", updates)
+	}
+}
+
+func TestCheckCache(t *testing.T) {
+	_, requests := upstream(t)
+	dir := t.TempDir()
+	catalog := Catalog{{Name: "gh", Version: "v1.4.0", GitHub: "owner/repo"}}
+
+	c := NewChecker(rate.Inf)
+	c.CacheDir = dir
+	for i := 0; i < 2; i++ {
+		if _, err := c.Check(context.Background(), catalog); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", got)
+	}
+
+	// A new Checker, like the next run of the CLI, picks up the cache file
+	c = NewChecker(rate.Inf)
+	c.CacheDir = dir
+	updates, err := c.Check(context.Background(), catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Fatalf("expected the cache file to be used, got %d upstream requests", got)
+	}
+	if len(updates) != 1 || updates[0].Latest != "v1.5.0" || updates[0].URL != "https://example.com/v1.5.0" {
+		t.Fatalf("unexpected updates from the cache: %v", updates)
+	}
+
+	// Expired entries are asked for again
+	c = NewChecker(rate.Inf)
+	c.CacheDir = dir
+	c.cache["github:owner/repo"] = cacheEntry{Version: "v1.5.0"}
+	if _, err := c.Check(context.Background(), catalog); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Fatalf("expected an expired entry to be refreshed, got %d upstream requests", got)
+	}
+}
@@ -0,0 +1,392 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// partitionDir is where PartitionNode keeps the KIND network IP of the nodes it took off
+// the network, so they get the same address back even from another process
+var partitionDir string = filepath.Join(os.TempDir(), "bekind-partitioned")
+
+// ChaosOption configures the node chaos helpers
+type ChaosOption func(*chaosOptions)
+
+type chaosOptions struct {
+	force       bool
+	client      kubernetes.Interface
+	timeout     time.Duration
+	rescheduled bool
+	namespaces  []string
+}
+
+// WithForce allows taking down the only control-plane node of a cluster
+func WithForce(force bool) ChaosOption {
+	return func(o *chaosOptions) {
+		o.force = force
+	}
+}
+
+// WithWaitForNodes waits up to timeout for the cluster to reflect the change,
+// e.g. the node going NotReady after KillNode or Ready again after RestartNode.
+// There's no API server to ask when the only control-plane is taken down (see WithForce),
+// so the wait is skipped then. It's skipped for the external load balancer of an HA cluster too,
+// it isn't a Kubernetes Node
+func WithWaitForNodes(c kubernetes.Interface, timeout time.Duration) ChaosOption {
+	return func(o *chaosOptions) {
+		o.client = c
+		o.timeout = timeout
+	}
+}
+
+// WithWaitForRescheduled also waits, after the node went NotReady, for the pods on it to be
+// moved elsewhere and for the Deployments of the namespaces (all of them if none are given)
+// to be fully ready again. It needs WithWaitForNodes for the client and timeout. Pods are
+// only evicted after their not-ready toleration, 5 minutes by default, so give it the time
+func WithWaitForRescheduled(namespaces ...string) ChaosOption {
+	return func(o *chaosOptions) {
+		o.rescheduled = true
+		o.namespaces = namespaces
+	}
+}
+
+// KillNode abruptly stops the node's container
+func KillNode(ctx context.Context, clusterName, nodeName string, opts ...ChaosOption) error {
+	o := chaosOpts(opts)
+
+	n, only, err := findNode(clusterName, nodeName, o.force)
+	if err != nil {
+		return err
+	}
+
+	if err := exec.CommandContext(ctx, runtimeBinary(), "kill", nodeName).Run(); err != nil {
+		return err
+	}
+
+	if only || isLoadBalancer(n) {
+		return nil
+	}
+	return o.waitForDown(nodeName)
+}
+
+// RestartNode stops and then starts the node's container
+func RestartNode(ctx context.Context, clusterName, nodeName string, opts ...ChaosOption) error {
+	o := chaosOpts(opts)
+
+	// The node comes right back, so restarting the only control-plane is allowed
+	n, _, err := findNode(clusterName, nodeName, true)
+	if err != nil {
+		return err
+	}
+
+	rt := runtimeBinary()
+	if err := exec.CommandContext(ctx, rt, "stop", nodeName).Run(); err != nil {
+		return err
+	}
+	if err := exec.CommandContext(ctx, rt, "start", nodeName).Run(); err != nil {
+		return err
+	}
+
+	if isLoadBalancer(n) {
+		return nil
+	}
+	return o.waitFor(nodeName, true)
+}
+
+// PartitionNode disconnects the node from the KIND network. If duration is more
+// than 0 the node is reconnected after that long, even if waiting fails or ctx is
+// done first. Otherwise it stays disconnected until RepairCluster is called
+func PartitionNode(ctx context.Context, clusterName, nodeName string, duration time.Duration, opts ...ChaosOption) (err error) {
+	o := chaosOpts(opts)
+
+	n, only, err := findNode(clusterName, nodeName, o.force)
+	if err != nil {
+		return err
+	}
+	// There's no Kubernetes Node to wait on for the external load balancer
+	noWait := only || isLoadBalancer(n)
+
+	// Remember the address so the node comes back the same
+	ipv4, _, err := n.IP()
+	if err != nil {
+		return err
+	}
+	if err := rememberIP(nodeName, ipv4); err != nil {
+		return err
+	}
+
+	if err := exec.CommandContext(ctx, runtimeBinary(), "network", "disconnect", kindNetwork(), nodeName).Run(); err != nil {
+		return err
+	}
+
+	if duration > 0 {
+		// The partition is temporary, so the node goes back however this ends. ctx may be done by now
+		defer func() {
+			rerr := reconnectNode(context.TODO(), nodeName)
+			if err == nil {
+				err = rerr
+			}
+			if err == nil && !noWait {
+				err = o.waitFor(nodeName, true)
+			}
+		}()
+	}
+
+	if !noWait {
+		if err := o.waitForDown(nodeName); err != nil {
+			return err
+		}
+	}
+	if duration <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+	}
+	return nil
+}
+
+// RepairCluster starts any stopped nodes of the cluster and puts any that are off the KIND
+// network back on it, including ones partitioned by another process
+func RepairCluster(ctx context.Context, clusterName string, opts ...ChaosOption) error {
+	o := chaosOpts(opts)
+	rt := runtimeBinary()
+
+	nodeList, err := provider().ListNodes(clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodeList {
+		name := n.String()
+
+		lines, err := exec.OutputLines(exec.CommandContext(ctx, rt, "inspect", "-f", "{{.State.Running}}", name))
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 && strings.TrimSpace(lines[0]) != "true" {
+			if err := exec.CommandContext(ctx, rt, "start", name).Run(); err != nil {
+				return err
+			}
+		}
+
+		connected, err := onKindNetwork(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !connected {
+			if err := reconnectNode(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, n := range nodeList {
+		if isLoadBalancer(n) {
+			continue
+		}
+		if err := o.waitFor(n.String(), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findNode returns the named node of the cluster and if it's the only control-plane
+// node. Unless force is set, it refuses to return the cluster's only control-plane node
+func findNode(clusterName, nodeName string, force bool) (nodes.Node, bool, error) {
+	nodeList, err := provider().ListNodes(clusterName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var node nodes.Node
+	controlPlanes := 0
+	for _, n := range nodeList {
+		role, err := n.Role()
+		if err != nil {
+			return nil, false, err
+		}
+		if role == constants.ControlPlaneNodeRoleValue {
+			controlPlanes++
+		}
+		if n.String() == nodeName {
+			node = n
+		}
+	}
+	if node == nil {
+		return nil, false, fmt.Errorf("node %q not found in cluster %q", nodeName, clusterName)
+	}
+
+	role, _ := node.Role()
+	only := role == constants.ControlPlaneNodeRoleValue && controlPlanes == 1
+	if only && !force {
+		return nil, false, fmt.Errorf("refusing to take down %q, it's the only control-plane node of cluster %q", nodeName, clusterName)
+	}
+
+	return node, only, nil
+}
+
+// isLoadBalancer checks to see if the node is the external load balancer of an HA
+// cluster, which has no Kubernetes Node to wait on
+func isLoadBalancer(n nodes.Node) bool {
+	role, _ := n.Role()
+	return role == constants.ExternalLoadBalancerNodeRoleValue
+}
+
+// reconnectNode puts a partitioned node back on the KIND network with its old address
+func reconnectNode(ctx context.Context, nodeName string) error {
+	args := []string{"network", "connect"}
+	if ip := rememberedIP(nodeName); ip != "" {
+		args = append(args, "--ip", ip)
+	}
+	args = append(args, kindNetwork(), nodeName)
+
+	if err := exec.CommandContext(ctx, runtimeBinary(), args...).Run(); err != nil {
+		return err
+	}
+	return forgetIP(nodeName)
+}
+
+// onKindNetwork checks to see if the container is attached to the KIND network
+func onKindNetwork(ctx context.Context, name string) (bool, error) {
+	lines, err := exec.OutputLines(exec.CommandContext(ctx, runtimeBinary(), "inspect", "-f",
+		"{{range $k, $v := .NetworkSettings.Networks}}{{$k}} {{end}}", name))
+	if err != nil {
+		return false, err
+	}
+
+	network := kindNetwork()
+	for _, l := range lines {
+		for _, n := range strings.Fields(l) {
+			if n == network {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// rememberIP keeps the node's KIND network IP in partitionDir
+func rememberIP(nodeName, ip string) error {
+	if err := os.MkdirAll(partitionDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(partitionDir, nodeName), []byte(ip), 0644)
+}
+
+// rememberedIP returns the IP kept by rememberIP, or "" if there isn't one
+func rememberedIP(nodeName string) string {
+	b, err := os.ReadFile(filepath.Join(partitionDir, nodeName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// forgetIP removes the IP kept by rememberIP
+func forgetIP(nodeName string) error {
+	if err := os.Remove(filepath.Join(partitionDir, nodeName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func chaosOpts(opts []ChaosOption) *chaosOptions {
+	o := &chaosOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// waitForDown waits for the node to be NotReady and, if asked for, its pods to be rescheduled
+func (o *chaosOptions) waitForDown(nodeName string) error {
+	if err := o.waitFor(nodeName, false); err != nil {
+		return err
+	}
+	if o.client == nil || !o.rescheduled {
+		return nil
+	}
+
+	namespaces := o.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	return wait.PollImmediate(5*time.Second, o.timeout, isRescheduled(o.client, nodeName, namespaces))
+}
+
+// isRescheduled checks to see if no pods (other than DaemonSet ones) are left running on the
+// node, and the Deployments of the namespaces have all their replicas ready
+func isRescheduled(c kubernetes.Interface, nodeName string, namespaces []string) wait.ConditionFunc {
+	return func() (bool, error) {
+		for _, ns := range namespaces {
+			pods, err := c.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: "spec.nodeName=" + nodeName,
+			})
+			if err != nil {
+				return false, err
+			}
+			for _, p := range pods.Items {
+				// Evicted pods stay Terminating until the node is back, that's fine
+				if p.DeletionTimestamp != nil || isDaemonSetPod(&p) {
+					continue
+				}
+				return false, nil
+			}
+
+			deps, err := c.AppsV1().Deployments(ns).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return false, err
+			}
+			for _, d := range deps.Items {
+				want := int32(1)
+				if d.Spec.Replicas != nil {
+					want = *d.Spec.Replicas
+				}
+				if d.Status.ReadyReplicas < want {
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	}
+}
+
+// isDaemonSetPod checks to see if the pod belongs to a DaemonSet, those stay on their node
+func isDaemonSetPod(p *corev1.Pod) bool {
+	for _, ref := range p.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// waitFor waits for the node to be Ready (or NotReady), if waiting was asked for
+func (o *chaosOptions) waitFor(nodeName string, ready bool) error {
+	if o.client == nil {
+		return nil
+	}
+	if ready {
+		return utils.WaitForNodeReady(o.client, nodeName, o.timeout)
+	}
+	return utils.WaitForNodeNotReady(o.client, nodeName, o.timeout)
+}
@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/utils"
+	kindcluster "sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+var (
+	providerOnce sync.Once
+	kindProvider *kindcluster.Provider
+)
+
+// provider returns the KIND provider used by this package, it uses the runtime from GetDefaultRuntime.
+// It's created on first use so a logger set with utils.SetLogger gets the runtime warnings
+func provider() *kindcluster.Provider {
+	providerOnce.Do(func() {
+		kindProvider = kindcluster.NewProvider(utils.GetDefaultRuntime())
+	})
+	return kindProvider
+}
+
+// Option configures CreateCluster and the teardown functions
+type Option func(*options)
+
+type options struct {
+	waitForReady   time.Duration
+	reuseExisting  bool
+	nodeImage      string
+	kubeConfigPath string
+	registryName   string
+	registryPort   int
+	confirm        []utils.Destructive
+}
+
+// WithWaitForReady waits up to the given duration for the control-plane to be ready
+func WithWaitForReady(wait time.Duration) Option {
+	return func(o *options) {
+		o.waitForReady = wait
+	}
+}
+
+// WithReuseExisting makes CreateCluster succeed if a cluster with that name already exists
+func WithReuseExisting(reuse bool) Option {
+	return func(o *options) {
+		o.reuseExisting = reuse
+	}
+}
+
+// WithNodeImage sets the node image to use, the KIND default is used otherwise
+func WithNodeImage(image string) Option {
+	return func(o *options) {
+		o.nodeImage = image
+	}
+}
+
+// WithKubeConfigPath writes the kubeconfig to the given path instead of the default one
+func WithKubeConfigPath(path string) Option {
+	return func(o *options) {
+		o.kubeConfigPath = path
+	}
+}
+
+// WithLocalRegistry starts (or adopts) the named registry on localhost:port and connects it
+// to the cluster. The config needs containerd's config_path set, like the "registry" preset does
+func WithLocalRegistry(name string, port int) Option {
+	return func(o *options) {
+		o.registryName = name
+		o.registryPort = port
+	}
+}
+
+// WithConfirm acknowledges destructive operations, like utils.DestructiveTeardown for DeleteCluster
+func WithConfirm(confirm ...utils.Destructive) Option {
+	return func(o *options) {
+		o.confirm = append(o.confirm, confirm...)
+	}
+}
+
+// CreateCluster creates a KIND cluster from the raw KIND Cluster config given as YAML
+func CreateCluster(name string, config []byte, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if name == "" {
+		name = constants.DefaultClusterName
+	}
+	if err := utils.ValidateClusterName(name); err != nil {
+		return err
+	}
+
+	// See if the cluster is already there
+	exists, err := clusterExists(name)
+	if err != nil {
+		return err
+	}
+	if exists && !o.reuseExisting {
+		return fmt.Errorf("cluster %q already exists", name)
+	}
+
+	if !exists {
+		if err := createCluster(name, config, o); err != nil {
+			return err
+		}
+	}
+
+	if o.registryName != "" {
+		if err := EnsureLocalRegistry(o.registryName, o.registryPort); err != nil {
+			return err
+		}
+		return ConnectRegistryToCluster(name, o.registryName)
+	}
+
+	return nil
+}
+
+// createCluster calls out to KIND to create the cluster
+func createCluster(name string, config []byte, o *options) error {
+	createOpts := []kindcluster.CreateOption{
+		kindcluster.CreateWithRawConfig(config),
+		kindcluster.CreateWithDisplayUsage(false),
+		kindcluster.CreateWithDisplaySalutation(false),
+		kindcluster.CreateWithWaitForReady(o.waitForReady),
+		kindcluster.CreateWithKubeconfigPath(o.kubeConfigPath),
+	}
+	if o.nodeImage != "" {
+		createOpts = append(createOpts, kindcluster.CreateWithNodeImage(o.nodeImage))
+	}
+
+	return provider().Create(name, createOpts...)
+}
+
+// DeleteCluster deletes the named KIND cluster. It needs utils.DestructiveTeardown to be confirmed
+func DeleteCluster(name string, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := utils.RequireConfirmation(o.confirm, utils.DestructiveTeardown); err != nil {
+		return err
+	}
+	return provider().Delete(name, o.kubeConfigPath)
+}
+
+// ListClusters returns the names of the KIND clusters
+func ListClusters() ([]string, error) {
+	return provider().List()
+}
+
+// GetKubeConfig returns the kubeconfig for the named cluster. If internal is set,
+// the kubeconfig points at the control-plane on the KIND network instead of the host
+func GetKubeConfig(name string, internal bool) (string, error) {
+	return provider().KubeConfig(name, internal)
+}
+
+// LoadImageArchive imports the image archive (like the output of "docker save") on every node of the named cluster
+func LoadImageArchive(name string, archive []byte) error {
+	// The external load balancer runs no workloads, and has no ctr to load images with
+	nodeList, err := provider().ListInternalNodes(name)
+	if err != nil {
+		return err
+	}
+	if len(nodeList) == 0 {
+		return fmt.Errorf("no nodes found for cluster %q", name)
+	}
+
+	for _, n := range nodeList {
+		if err := nodeutils.LoadImageArchive(n, bytes.NewReader(archive)); err != nil {
+			return fmt.Errorf("loading image on %s: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// clusterExists checks to see if the named cluster exists
+func clusterExists(name string) (bool, error) {
+	clusters, err := ListClusters()
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range clusters {
+		if c == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
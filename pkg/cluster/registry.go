@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/christianh814/bekind/pkg/utils"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+const (
+	// DefaultRegistryName is the name of the local registry container
+	DefaultRegistryName = "kind-registry"
+	// DefaultRegistryPort is the port the local registry is published on, on localhost
+	DefaultRegistryPort = 5001
+	// RegistryImage is the image used to run the local registry
+	RegistryImage = "registry:2"
+)
+
+// hostsDir is where containerd looks for registry configs. The cluster needs to be
+// created with containerd's config_path pointed here (see the "registry" preset)
+var hostsDir string = "/etc/containerd/certs.d"
+
+// containerdConfig is the containerd config on the KIND nodes, with the kind config patches merged in
+var containerdConfig string = "/etc/containerd/config.toml"
+
+// configPathRe matches containerd's config_path setting pointed at hostsDir
+var configPathRe = regexp.MustCompile(`(?m)^\s*config_path\s*=\s*["']` + regexp.QuoteMeta(hostsDir) + `["']`)
+
+// localRegistryHosting is the ConfigMap documented in KEP-1755 so tools can find the registry
+var localRegistryHosting string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "localhost:%d"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+`
+
+// EnsureLocalRegistry starts the named registry container published on localhost:port.
+// An existing container with that name is adopted (and started if it was stopped).
+// The name is passed through utils.SanitizeName, like in the other registry functions
+func EnsureLocalRegistry(name string, port int) error {
+	name = utils.SanitizeName(name)
+	rt := runtimeBinary()
+
+	lines, err := exec.OutputLines(exec.Command(rt, "inspect", "-f", "{{.State.Running}}", name))
+	if err == nil && len(lines) > 0 {
+		if strings.TrimSpace(lines[0]) == "true" {
+			return nil
+		}
+		return exec.Command(rt, "start", name).Run()
+	}
+
+	return exec.Command(rt, "run",
+		"-d",
+		"--restart=always",
+		"-p", fmt.Sprintf("127.0.0.1:%d:5000", port),
+		"--name", name,
+		RegistryImage,
+	).Run()
+}
+
+// ConnectRegistryToCluster attaches the named registry to the KIND network, configures
+// containerd on every node of the cluster to use it for localhost:<port> and publishes
+// the local-registry-hosting ConfigMap. The cluster has to be created with containerd's
+// config_path set (see the "registry" preset), otherwise an error is returned
+func ConnectRegistryToCluster(clusterName, registryName string) error {
+	registryName = utils.SanitizeName(registryName)
+	rt := runtimeBinary()
+
+	port, err := registryPort(registryName)
+	if err != nil {
+		return err
+	}
+
+	// Point containerd on each node at the registry, the external load balancer runs no containerd
+	nodes, err := provider().ListInternalNodes(clusterName)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no nodes found for cluster %q", clusterName)
+	}
+
+	// containerd ignores hosts.toml unless config_path was set when the cluster was created
+	for _, n := range nodes {
+		lines, err := exec.OutputLines(n.Command("cat", containerdConfig))
+		if err != nil {
+			return fmt.Errorf("reading the containerd config on %s: %w", n, err)
+		}
+		if !configPathRe.MatchString(strings.Join(lines, "\n")) {
+			return fmt.Errorf("containerd on %s doesn't read registry configs from %s, create the cluster with the \"registry\" preset", n, hostsDir)
+		}
+	}
+
+	dir := fmt.Sprintf("%s/localhost:%d", hostsDir, port)
+	hosts := fmt.Sprintf("[host.\"http://%s:5000\"]\n", registryName)
+	for _, n := range nodes {
+		if err := n.Command("mkdir", "-p", dir).Run(); err != nil {
+			return fmt.Errorf("configuring containerd on %s: %w", n, err)
+		}
+		if err := n.Command("cp", "/dev/stdin", dir+"/hosts.toml").SetStdin(strings.NewReader(hosts)).Run(); err != nil {
+			return fmt.Errorf("configuring containerd on %s: %w", n, err)
+		}
+	}
+
+	// Attach the registry to the KIND network if it isn't already
+	connected, err := onKindNetwork(context.TODO(), registryName)
+	if err != nil {
+		return err
+	}
+	if !connected {
+		if err := exec.Command(rt, "network", "connect", kindNetwork(), registryName).Run(); err != nil {
+			return err
+		}
+	}
+
+	// Let tools know where the registry is
+	kubeConfig, err := GetKubeConfig(clusterName, false)
+	if err != nil {
+		return err
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeConfig))
+	if err != nil {
+		return err
+	}
+	return utils.DoSSA(context.TODO(), cfg, []byte(fmt.Sprintf(localRegistryHosting, port)))
+}
+
+// TeardownLocalRegistry removes the named registry container. Deleting a cluster leaves
+// the registry running so the image cache survives recreating the cluster.
+// It needs utils.DestructiveTeardown to be confirmed
+func TeardownLocalRegistry(name string, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := utils.RequireConfirmation(o.confirm, utils.DestructiveTeardown); err != nil {
+		return err
+	}
+	return exec.Command(runtimeBinary(), "rm", "-f", utils.SanitizeName(name)).Run()
+}
+
+// registryPort returns the localhost port the registry is published on
+func registryPort(name string) (int, error) {
+	lines, err := exec.OutputLines(exec.Command(runtimeBinary(), "port", name, "5000/tcp"))
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, fmt.Errorf("registry %q isn't published on the host", name)
+	}
+
+	// Output looks like 127.0.0.1:5001
+	addr := strings.TrimSpace(lines[0])
+	port, err := strconv.Atoi(addr[strings.LastIndex(addr, ":")+1:])
+	if err != nil {
+		return 0, fmt.Errorf("parsing port %q of registry %q: %w", addr, name, err)
+	}
+	return port, nil
+}
+
+// runtimeBinary returns the container runtime CLI, following what GetDefaultRuntime picks
+func runtimeBinary() string {
+	switch os.Getenv("KIND_EXPERIMENTAL_PROVIDER") {
+	case "podman":
+		return "podman"
+	case "docker":
+		return "docker"
+	}
+
+	// KIND prefers docker when it's around
+	if _, err := osexec.LookPath("docker"); err != nil {
+		if _, err := osexec.LookPath("podman"); err == nil {
+			return "podman"
+		}
+	}
+	return "docker"
+}
+
+// kindNetwork returns the name of the network the KIND nodes are on
+func kindNetwork() string {
+	env := "KIND_EXPERIMENTAL_DOCKER_NETWORK"
+	if runtimeBinary() == "podman" {
+		env = "KIND_EXPERIMENTAL_PODMAN_NETWORK"
+	}
+	if n := os.Getenv(env); n != "" {
+		return n
+	}
+	return "kind"
+}
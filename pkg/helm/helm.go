@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/christianh814/bekind/pkg/utils"
 
 	"gopkg.in/yaml.v2"
 
@@ -24,8 +25,18 @@ import (
 	"helm.sh/helm/v3/pkg/cli/values"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"helm.sh/helm/v3/pkg/strvals"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	memory "k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 var settings *cli.EnvSettings
@@ -138,7 +149,7 @@ func RepoUpdate() error {
 		go func(re *repo.ChartRepository) {
 			defer wg.Done()
 			if _, err := re.DownloadIndexFile(); err != nil {
-				log.Infof("...Unable to get an update from the %q chart repository (%s):\n\t%s\n", re.Config.Name, re.Config.URL, err)
+				utils.GetLogger().Info("unable to get an update from the chart repository", "repo", re.Config.Name, "url", re.Config.URL, "error", err)
 			}
 		}(re)
 	}
@@ -148,7 +159,7 @@ func RepoUpdate() error {
 	return nil
 }
 
-// InstallChart
+// InstallChart installs a chart from a repo previously added with RepoAdd
 func InstallChart(name, repo, chart string, args map[string]string) error {
 	actionConfig := new(action.Configuration)
 	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), debug); err != nil {
@@ -226,6 +237,188 @@ func InstallChart(name, repo, chart string, args map[string]string) error {
 	return nil
 }
 
+// ChartOption configures InstallChartWithConfig
+type ChartOption func(*chartOptions)
+
+type chartOptions struct {
+	releaseName string
+	timeout     time.Duration
+	atomic      bool
+	wait        bool
+}
+
+// WithReleaseName sets the release name, which defaults to the chart name
+func WithReleaseName(name string) ChartOption {
+	return func(o *chartOptions) {
+		o.releaseName = name
+	}
+}
+
+// WithTimeout sets how long to wait for the install or upgrade to finish
+func WithTimeout(timeout time.Duration) ChartOption {
+	return func(o *chartOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithAtomic rolls back (or uninstalls) the release if the install or upgrade fails
+func WithAtomic(atomic bool) ChartOption {
+	return func(o *chartOptions) {
+		o.atomic = atomic
+	}
+}
+
+// WithWait waits for the release resources to become ready
+func WithWait(wait bool) ChartOption {
+	return func(o *chartOptions) {
+		o.wait = wait
+	}
+}
+
+// InstallChartWithConfig installs the chart from repoURL into namespace using the given *rest.Config.
+// If the release already exists it gets upgraded instead, so running it again converges.
+// The repoURL can also be an oci:// reference, in which case the chart is appended to it.
+func InstallChartWithConfig(ctx context.Context, cfg *rest.Config, repoURL, chartName, version, namespace string, vals map[string]interface{}, opts ...ChartOption) error {
+	o := &chartOptions{timeout: 5 * time.Minute}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	envSettings := cli.New()
+	envSettings.SetNamespace(namespace)
+
+	// Set up a helm action configuration for the given cluster
+	actionConfig := new(action.Configuration)
+	clientGetter := &restClientGetter{config: cfg, namespace: namespace}
+	if err := actionConfig.Init(clientGetter, namespace, os.Getenv("HELM_DRIVER"), debug); err != nil {
+		return err
+	}
+
+	// A registry client is needed for oci:// charts
+	registryClient, err := registry.NewClient(
+		registry.ClientOptCredentialsFile(envSettings.RegistryConfig),
+	)
+	if err != nil {
+		return err
+	}
+	actionConfig.RegistryClient = registryClient
+
+	// OCI charts are referenced directly instead of through a repo
+	chartRef := chartName
+	if registry.IsOCI(repoURL) {
+		chartRef = strings.TrimSuffix(repoURL, "/")
+		if chartName != "" {
+			chartRef = chartRef + "/" + chartName
+		}
+		repoURL = ""
+	}
+	if o.releaseName == "" {
+		o.releaseName = path.Base(chartRef)
+	}
+
+	// See if the release is already there so we know to install or upgrade
+	history := action.NewHistory(actionConfig)
+	history.Max = 1
+	_, err = history.Run(o.releaseName)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return err
+	}
+
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		client := action.NewInstall(actionConfig)
+		client.ReleaseName = o.releaseName
+		client.Namespace = namespace
+		client.CreateNamespace = true
+		client.Version = version
+		client.RepoURL = repoURL
+		client.Timeout = o.timeout
+		client.Atomic = o.atomic
+		client.Wait = o.wait || o.atomic
+
+		chartRequested, err := loadChart(&client.ChartPathOptions, chartRef, envSettings)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.RunWithContext(ctx, chartRequested, vals)
+		return err
+	}
+
+	client := action.NewUpgrade(actionConfig)
+	client.Namespace = namespace
+	client.Version = version
+	client.RepoURL = repoURL
+	client.Timeout = o.timeout
+	client.Atomic = o.atomic
+	client.Wait = o.wait || o.atomic
+
+	chartRequested, err := loadChart(&client.ChartPathOptions, chartRef, envSettings)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.RunWithContext(ctx, o.releaseName, chartRequested, vals)
+	return err
+}
+
+// loadChart downloads and loads the chart, making sure it's installable and its dependencies are present
+func loadChart(cpo *action.ChartPathOptions, chartRef string, envSettings *cli.EnvSettings) (*chart.Chart, error) {
+	cp, err := cpo.LocateChart(chartRef, envSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	chartRequested, err := loader.Load(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := isChartInstallable(chartRequested); !ok {
+		return nil, err
+	}
+
+	if req := chartRequested.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(chartRequested, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return chartRequested, nil
+}
+
+// restClientGetter lets the helm SDK talk to the cluster of an existing *rest.Config
+type restClientGetter struct {
+	config    *rest.Config
+	namespace string
+}
+
+func (r *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(r.config), nil
+}
+
+func (r *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(r.config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(dc), nil
+}
+
+func (r *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	dc, err := r.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(dc)
+	return restmapper.NewShortcutExpander(mapper, dc), nil
+}
+
+func (r *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: clientcmdapi.Context{Namespace: r.namespace},
+	})
+}
+
 func isChartInstallable(ch *chart.Chart) (bool, error) {
 	switch ch.Metadata.Type {
 	case "", "application":
@@ -235,5 +428,5 @@ func isChartInstallable(ch *chart.Chart) (bool, error) {
 }
 
 func debug(format string, v ...interface{}) {
-	format = fmt.Sprintf("[debug] %s\n", format)
+	utils.GetLogger().Debug(fmt.Sprintf(format, v...), "component", "helm")
 }
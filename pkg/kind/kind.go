@@ -2,6 +2,7 @@ package kind
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/christianh814/bekind/pkg/utils"
 	"github.com/spf13/viper"
@@ -59,13 +60,27 @@ nodes:
     listenAddress: 0.0.0.0
 `
 
-// We are using the same kind of provider for this whole package
-var Provider *cluster.Provider = cluster.NewProvider(
-	utils.GetDefaultRuntime(),
+var (
+	providerOnce sync.Once
+	kindProvider *cluster.Provider
 )
 
+// Provider returns the KIND provider used by this whole package. It's created on first
+// use so a logger set with utils.SetLogger gets the runtime warnings
+func Provider() *cluster.Provider {
+	providerOnce.Do(func() {
+		kindProvider = cluster.NewProvider(utils.GetDefaultRuntime())
+	})
+	return kindProvider
+}
+
 // CreateKindCluster creates KIND cluster
 func CreateKindCluster(name string, installtype string, kindImage string) error {
+	// Catch bad names before KIND creates anything with them
+	if err := utils.ValidateClusterName(name); err != nil {
+		return err
+	}
+
 	// Check to see what kind of install type we want
 	switch installtype {
 	case "":
@@ -77,7 +92,15 @@ func CreateKindCluster(name string, installtype string, kindImage string) error
 	case "custom":
 		installtype = viper.GetString("kindConfig")
 	default:
-		return errors.New("invalid install type")
+		// Fall back to looking up a preset by that name
+		opts, err := GetPreset(installtype)
+		if err != nil {
+			return errors.New("invalid install type")
+		}
+		installtype, err = opts.KindConfig()
+		if err != nil {
+			return err
+		}
 	}
 
 	// If a config file is given, try to use that. Garbage in, garbage out though
@@ -87,7 +110,7 @@ func CreateKindCluster(name string, installtype string, kindImage string) error
 	}
 
 	// Create a KIND instance and write out the kubeconfig in the specified location
-	err := Provider.Create(
+	err := Provider().Create(
 		name,
 		cluster.CreateWithRawConfig([]byte(installtype)),
 		cluster.CreateWithDisplayUsage(false),
@@ -102,9 +125,14 @@ func CreateKindCluster(name string, installtype string, kindImage string) error
 	return nil
 }
 
-// DeleteKindCluster deletes KIND cluster based on the name given
-func DeleteKindCluster(name string, cfg string) error {
-	err := Provider.Delete(name, cfg)
+// DeleteKindCluster deletes KIND cluster based on the name given. Like cluster.DeleteCluster,
+// it needs utils.DestructiveTeardown in confirm
+func DeleteKindCluster(name string, cfg string, confirm ...utils.Destructive) error {
+	if err := utils.RequireConfirmation(confirm, utils.DestructiveTeardown); err != nil {
+		return err
+	}
+
+	err := Provider().Delete(name, cfg)
 
 	if err != nil {
 		return err
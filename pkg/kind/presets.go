@@ -0,0 +1,251 @@
+package kind
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+// ClusterOptions describes the shape of a KIND cluster. Fields left as nil (or "")
+// are unset, which is what lets presets be composed on top of one another.
+type ClusterOptions struct {
+	ControlPlanes     *int
+	Workers           *int
+	DisableDefaultCNI *bool
+	IPFamily          string
+	PodSubnet         string
+	ServiceSubnet     string
+	Ingress           *bool
+	LocalRegistry     *bool
+}
+
+// registryConfigPatch points containerd at the certs.d directory so the local
+// registry can be wired in per node after the cluster is created
+var registryConfigPatch string = `[plugins."io.containerd.grpc.v1.cri".registry]
+  config_path = "/etc/containerd/certs.d"
+`
+
+var ingressInitPatch string = `kind: InitConfiguration
+nodeRegistration:
+  kubeletExtraArgs:
+    node-labels: "nginx=ingresshost"
+`
+
+var ingressJoinPatch string = `kind: JoinConfiguration
+nodeRegistration:
+  kubeletExtraArgs:
+    node-labels: "nginx=ingresshost"
+`
+
+var (
+	presetsMu sync.RWMutex
+	presets   = map[string]ClusterOptions{
+		"ingress": {
+			Ingress: boolPtr(true),
+		},
+		"minimal": {
+			ControlPlanes:     intPtr(1),
+			Workers:           intPtr(0),
+			DisableDefaultCNI: boolPtr(false),
+		},
+		"ha": {
+			ControlPlanes: intPtr(3),
+			Workers:       intPtr(2),
+		},
+		"registry": {
+			LocalRegistry: boolPtr(true),
+		},
+		"netpol": {
+			// Calico gets installed by bekind when the default CNI is disabled
+			DisableDefaultCNI: boolPtr(true),
+			PodSubnet:         "10.254.0.0/16",
+		},
+		"dualstack": {
+			IPFamily: string(v1alpha4.DualStackFamily),
+		},
+	}
+)
+
+// GetPreset returns the named preset
+func GetPreset(name string) (ClusterOptions, error) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	opts, ok := presets[name]
+	if !ok {
+		return ClusterOptions{}, fmt.Errorf("unknown preset %q", name)
+	}
+	return opts, nil
+}
+
+// RegisterPreset adds a custom preset. Presets that already exist can't be overwritten
+func RegisterPreset(name string, opts ClusterOptions) error {
+	if name == "" {
+		return fmt.Errorf("preset name can't be empty")
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+
+	if _, ok := presets[name]; ok {
+		return fmt.Errorf("preset %q already exists", name)
+	}
+	presets[name] = opts
+	return nil
+}
+
+// Presets returns the sorted names of all known presets
+func Presets() []string {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	var names []string
+	for n := range presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ComposePresets merges the named presets in order. It returns an error
+// if two presets set the same field to different values
+func ComposePresets(names ...string) (ClusterOptions, error) {
+	var opts ClusterOptions
+	for _, n := range names {
+		p, err := GetPreset(n)
+		if err != nil {
+			return ClusterOptions{}, err
+		}
+		if err := opts.Merge(p); err != nil {
+			return ClusterOptions{}, fmt.Errorf("preset %q: %w", n, err)
+		}
+	}
+	return opts, nil
+}
+
+// Merge sets any field from other on o, failing on contradicting values
+func (o *ClusterOptions) Merge(other ClusterOptions) error {
+	var conflicts []string
+
+	mergeInt := func(field string, dst **int, src *int) {
+		if src == nil {
+			return
+		}
+		if *dst != nil && **dst != *src {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%d != %d)", field, **dst, *src))
+			return
+		}
+		*dst = src
+	}
+	mergeBool := func(field string, dst **bool, src *bool) {
+		if src == nil {
+			return
+		}
+		if *dst != nil && **dst != *src {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%t != %t)", field, **dst, *src))
+			return
+		}
+		*dst = src
+	}
+	mergeString := func(field string, dst *string, src string) {
+		if src == "" {
+			return
+		}
+		if *dst != "" && *dst != src {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%q != %q)", field, *dst, src))
+			return
+		}
+		*dst = src
+	}
+
+	mergeInt("controlPlanes", &o.ControlPlanes, other.ControlPlanes)
+	mergeInt("workers", &o.Workers, other.Workers)
+	mergeBool("disableDefaultCNI", &o.DisableDefaultCNI, other.DisableDefaultCNI)
+	mergeString("ipFamily", &o.IPFamily, other.IPFamily)
+	mergeString("podSubnet", &o.PodSubnet, other.PodSubnet)
+	mergeString("serviceSubnet", &o.ServiceSubnet, other.ServiceSubnet)
+	mergeBool("ingress", &o.Ingress, other.Ingress)
+	mergeBool("localRegistry", &o.LocalRegistry, other.LocalRegistry)
+
+	if len(conflicts) != 0 {
+		return fmt.Errorf("conflicting fields: %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// KindConfig renders the options as a KIND cluster config
+func (o ClusterOptions) KindConfig() (string, error) {
+	controlPlanes := 1
+	if o.ControlPlanes != nil {
+		controlPlanes = *o.ControlPlanes
+	}
+	workers := 0
+	if o.Workers != nil {
+		workers = *o.Workers
+	}
+	if controlPlanes < 1 {
+		return "", fmt.Errorf("at least one control-plane node is needed")
+	}
+	if workers < 0 {
+		return "", fmt.Errorf("workers can't be negative")
+	}
+
+	c := v1alpha4.Cluster{
+		TypeMeta: v1alpha4.TypeMeta{
+			Kind:       "Cluster",
+			APIVersion: "kind.x-k8s.io/v1alpha4",
+		},
+		Networking: v1alpha4.Networking{
+			IPFamily:      v1alpha4.ClusterIPFamily(o.IPFamily),
+			PodSubnet:     o.PodSubnet,
+			ServiceSubnet: o.ServiceSubnet,
+		},
+	}
+	if o.DisableDefaultCNI != nil {
+		c.Networking.DisableDefaultCNI = *o.DisableDefaultCNI
+	}
+
+	for i := 0; i < controlPlanes; i++ {
+		c.Nodes = append(c.Nodes, v1alpha4.Node{Role: v1alpha4.ControlPlaneRole})
+	}
+	for i := 0; i < workers; i++ {
+		c.Nodes = append(c.Nodes, v1alpha4.Node{Role: v1alpha4.WorkerRole})
+	}
+
+	// The ingress controller lands on the first worker, or the control-plane if there are none
+	if o.Ingress != nil && *o.Ingress {
+		n := &c.Nodes[0]
+		patch := ingressInitPatch
+		if workers > 0 {
+			n = &c.Nodes[controlPlanes]
+			patch = ingressJoinPatch
+		}
+		n.KubeadmConfigPatches = append(n.KubeadmConfigPatches, patch)
+		n.ExtraPortMappings = append(n.ExtraPortMappings,
+			v1alpha4.PortMapping{ContainerPort: 80, HostPort: 80, ListenAddress: "0.0.0.0"},
+			v1alpha4.PortMapping{ContainerPort: 443, HostPort: 443, ListenAddress: "0.0.0.0"},
+		)
+	}
+
+	if o.LocalRegistry != nil && *o.LocalRegistry {
+		c.ContainerdConfigPatches = append(c.ContainerdConfigPatches, registryConfigPatch)
+	}
+
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
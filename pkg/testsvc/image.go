@@ -0,0 +1,162 @@
+package testsvc
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ImageRepository is what the image built by BuildImageArchive is called, it's tagged with a hash of the binary
+var ImageRepository string = "bekind.local/testsvc"
+
+// CanBuildImage checks to see if BuildImageArchive can work with the running binary, so
+// callers can fail before creating anything. Only a statically linked linux binary works,
+// like a build with CGO_ENABLED=0, and the KIND nodes have to be of the same architecture.
+// The image holds the whole bekind binary, about 70MB (less with -ldflags "-s -w"), and building
+// it takes about three times that in memory. It's copied to every node of the cluster
+func CanBuildImage() error {
+	_, err := executable()
+	return err
+}
+
+// BuildImageArchive returns a "docker save" style archive of a scratch image that has the
+// running bekind binary as /bekind, and the reference the image is tagged with. See CanBuildImage
+func BuildImageArchive() (string, []byte, error) {
+	exe, err := executable()
+	if err != nil {
+		return "", nil, err
+	}
+	bin, err := os.ReadFile(exe)
+	if err != nil {
+		return "", nil, err
+	}
+	return buildImageArchive(bin, runtime.GOARCH)
+}
+
+// executable returns the path of the running binary if it can run in a scratch image
+func executable() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("the test services image can only be built by a linux build of bekind, not %s; use an image with bekind in it instead", runtime.GOOS)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStatic(exe); err != nil {
+		return "", err
+	}
+	return exe, nil
+}
+
+// buildImageArchive does the work for BuildImageArchive with the binary bin built for arch
+func buildImageArchive(bin []byte, arch string) (string, []byte, error) {
+	// The one layer, with timestamps zeroed so the same binary gives the same image
+	layer, err := tarFiles(tarFile{name: "bekind", mode: 0755, data: bin})
+	if err != nil {
+		return "", nil, err
+	}
+	layerDigest := digest(layer)
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": arch,
+		"os":           "linux",
+		"config": map[string]interface{}{
+			"Entrypoint": []string{"/bekind"},
+			"User":       "65532",
+		},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{"sha256:" + layerDigest},
+		},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	configDigest := digest(config)
+
+	ref := fmt.Sprintf("%s:%s", ImageRepository, layerDigest[:12])
+	manifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   configDigest + ".json",
+		"RepoTags": []string{ref},
+		"Layers":   []string{layerDigest + "/layer.tar"},
+	}})
+	if err != nil {
+		return "", nil, err
+	}
+
+	archive, err := tarFiles(
+		tarFile{name: configDigest + ".json", mode: 0644, data: config},
+		tarFile{name: layerDigest + "/layer.tar", mode: 0644, data: layer},
+		tarFile{name: "manifest.json", mode: 0644, data: manifest},
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	return ref, archive, nil
+}
+
+// checkStatic makes sure the binary doesn't need a dynamic loader, there's none in a scratch image
+func checkStatic(path string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return fmt.Errorf("%s is dynamically linked, build it with CGO_ENABLED=0 or use an image with bekind in it instead", path)
+		}
+	}
+	return nil
+}
+
+type tarFile struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// tarFiles returns a tar of the files owned by root, with a zero modification time
+func tarFiles(files ...tarFile) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     f.mode,
+			Size:     int64(len(f.data)),
+			ModTime:  time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// digest returns the hex SHA-256 of b
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
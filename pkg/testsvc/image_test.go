@@ -0,0 +1,120 @@
+package testsvc
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// untar returns the headers and contents of the files in a tar, in order
+func untar(t *testing.T, b []byte) ([]*tar.Header, map[string][]byte) {
+	t.Helper()
+
+	var hdrs []*tar.Header
+	files := map[string][]byte{}
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdrs = append(hdrs, hdr)
+		files[hdr.Name] = data
+	}
+	return hdrs, files
+}
+
+func TestBuildImageArchive(t *testing.T) {
+	bin := []byte("\x7fELF not really a binary")
+
+	ref, archive, err := buildImageArchive(bin, "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same binary gives the same bytes, and so the same tag
+	ref2, archive2, err := buildImageArchive(bin, "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != ref2 || !bytes.Equal(archive, archive2) {
+		t.Fatal("building the same binary twice gave different archives")
+	}
+	if !strings.HasPrefix(ref, ImageRepository+":") {
+		t.Errorf("ref %q isn't in %s", ref, ImageRepository)
+	}
+
+	// A docker save layout: the config, the one layer, then the manifest pointing at both
+	hdrs, files := untar(t, archive)
+	var names []string
+	for _, hdr := range hdrs {
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s: expected root owned with a zero modification time, got %+v", hdr.Name, hdr)
+		}
+	}
+	if len(names) != 3 || !strings.HasSuffix(names[0], ".json") || !strings.HasSuffix(names[1], "/layer.tar") || names[2] != "manifest.json" {
+		t.Fatalf("unexpected archive layout %v", names)
+	}
+
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 1 || manifest[0].Config != names[0] || !reflect.DeepEqual(manifest[0].Layers, []string{names[1]}) || !reflect.DeepEqual(manifest[0].RepoTags, []string{ref}) {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	if got := digest(files[names[0]]) + ".json"; got != names[0] {
+		t.Errorf("config is named %s, but its digest is %s", names[0], got)
+	}
+
+	var config struct {
+		Architecture string
+		OS           string
+		Config       struct{ Entrypoint []string }
+		RootFS       struct {
+			DiffIDs []string `json:"diff_ids"`
+		}
+	}
+	if err := json.Unmarshal(files[names[0]], &config); err != nil {
+		t.Fatal(err)
+	}
+	layerDigest := digest(files[names[1]])
+	if config.Architecture != "arm64" || config.OS != "linux" || !reflect.DeepEqual(config.Config.Entrypoint, []string{"/bekind"}) || !reflect.DeepEqual(config.RootFS.DiffIDs, []string{"sha256:" + layerDigest}) {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if names[1] != layerDigest+"/layer.tar" {
+		t.Errorf("layer is named %s, but its digest is %s", names[1], layerDigest)
+	}
+
+	// The layer has just the binary, executable
+	layerHdrs, layerFiles := untar(t, files[names[1]])
+	if len(layerHdrs) != 1 || layerHdrs[0].Name != "bekind" || layerHdrs[0].Mode != 0755 || !bytes.Equal(layerFiles["bekind"], bin) {
+		t.Errorf("unexpected layer %+v", layerHdrs)
+	}
+
+	// A different binary is a different tag
+	ref3, _, err := buildImageArchive([]byte("something else"), "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref3 == ref {
+		t.Errorf("different binaries got the same ref %s", ref)
+	}
+}
@@ -0,0 +1,103 @@
+package testsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// EchoResponse is what the echo server answers every request with
+type EchoResponse struct {
+	Hostname   string      `json:"hostname"`
+	Method     string      `json:"method"`
+	Host       string      `json:"host"`
+	Path       string      `json:"path"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Headers    http.Header `json:"headers"`
+}
+
+// ServeEcho runs the echo HTTP server on addr until ctx is done. Every request gets its
+// own details back as JSON, except /healthz which just answers "ok"
+func ServeEcho(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           echoHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// echoHandler answers the requests of the echo server
+func echoHandler() http.Handler {
+	hostname, _ := os.Hostname()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EchoResponse{
+			Hostname:   hostname,
+			Method:     r.Method,
+			Host:       r.Host,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			Headers:    r.Header,
+		})
+	})
+	return mux
+}
+
+// LookupHost resolves name with the resolver of the pod it runs in, so search domains apply
+func LookupHost(ctx context.Context, name string) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, name)
+}
+
+// CheckHTTP does a GET of the URL and returns the body, anything but a 2xx is an error
+func CheckHTTP(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return string(body), fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return string(body), nil
+}
+
+// CheckTCP makes sure a TCP connection to addr can be opened
+func CheckTCP(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
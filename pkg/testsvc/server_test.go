@@ -0,0 +1,110 @@
+package testsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEchoHandler(t *testing.T) {
+	srv := httptest.NewServer(echoHandler())
+	defer srv.Close()
+
+	body, err := CheckHTTP(context.Background(), srv.URL+"/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "ok\n" {
+		t.Errorf("/healthz body = %q, want %q", body, "ok\n")
+	}
+
+	body, err = CheckHTTP(context.Background(), srv.URL+"/some/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp EchoResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+	if resp.Method != http.MethodGet || resp.Path != "/some/path" || resp.Host != strings.TrimPrefix(srv.URL, "http://") {
+		t.Errorf("unexpected echo response %+v", resp)
+	}
+	if resp.RemoteAddr == "" || resp.Headers.Get("User-Agent") == "" {
+		t.Errorf("expected the remote address and headers to be echoed, got %+v", resp)
+	}
+}
+
+func TestCheckHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.Error(w, "not here", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	body, err := CheckHTTP(context.Background(), srv.URL)
+	if err != nil || body != "hello" {
+		t.Errorf("CheckHTTP = %q, %v, want %q, nil", body, err, "hello")
+	}
+
+	// The body is still returned with the error, so it can be shown
+	body, err = CheckHTTP(context.Background(), srv.URL+"/missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+	if body != "not here\n" {
+		t.Errorf("body = %q, want %q", body, "not here\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CheckHTTP(ctx, srv.URL); err == nil {
+		t.Error("expected an error with a cancelled context")
+	}
+}
+
+func TestServeEcho(t *testing.T) {
+	// Find a free port for the server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeEcho(ctx, addr) }()
+
+	// Wait for it to come up
+	var body string
+	for i := 0; i < 50; i++ {
+		if body, err = CheckHTTP(context.Background(), "http://"+addr+"/healthz"); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil || body != "ok\n" {
+		t.Fatalf("/healthz = %q, %v", body, err)
+	}
+	if err := CheckTCP(context.Background(), addr); err != nil {
+		t.Errorf("CheckTCP: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeEcho returned %v after the context was done, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeEcho didn't stop after the context was done")
+	}
+}
@@ -0,0 +1,295 @@
+package testsvc
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/christianh814/bekind/pkg/cluster"
+	"github.com/christianh814/bekind/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+)
+
+//go:embed manifests/*.yaml
+var manifests embed.FS
+
+const (
+	// DefaultNamespace is where the test services are deployed
+	DefaultNamespace = "bekind-testsvc"
+	// DefaultEchoName is the name of the echo Deployment and Service
+	DefaultEchoName = "bekind-echo"
+	// DefaultProbeName is the name of the probe Pod
+	DefaultProbeName = "bekind-probe"
+)
+
+// DefaultTimeout is how long the test services get to become ready
+var DefaultTimeout time.Duration = 2 * time.Minute
+
+// Option configures DeployTestEcho, DeployProbePod and Verify
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	name        string
+	image       string
+	clusterName string
+	timeout     time.Duration
+}
+
+// WithNamespace deploys into the given namespace instead of DefaultNamespace, it's created if needed.
+// Like WithName, it's passed through utils.SanitizeName
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithName names the objects that are deployed, after passing it through utils.SanitizeName
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithImage uses the given image, which has to have bekind as /bekind, instead of building
+// one from the running binary and loading it into the cluster
+func WithImage(image string) Option {
+	return func(o *options) {
+		o.image = image
+	}
+}
+
+// WithClusterName is the KIND cluster the image is loaded into, "kind" is used if not set
+func WithClusterName(name string) Option {
+	return func(o *options) {
+		o.clusterName = name
+	}
+}
+
+// WithTimeout is how long to wait for what's deployed to be ready
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Handle is what DeployTestEcho or DeployProbePod deployed
+type Handle struct {
+	Namespace string
+	Name      string
+	// Selector matches the pods that were deployed
+	Selector string
+
+	cleanup func(ctx context.Context) error
+}
+
+// Cleanup deletes what was deployed. The namespace is left alone since it may be shared
+func (h *Handle) Cleanup(ctx context.Context) error {
+	return h.cleanup(ctx)
+}
+
+// DeployTestEcho deploys the echo HTTP server as a Deployment and a Service on port 80, and
+// waits for it to have a ready endpoint. The Handle is returned even if waiting fails so
+// what was deployed can be cleaned up
+func DeployTestEcho(ctx context.Context, cfg *rest.Config, opts ...Option) (*Handle, error) {
+	o := newOptions(DefaultEchoName, opts)
+	c, err := deploy(ctx, cfg, "manifests/echo.yaml", o)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHandle(o, func(ctx context.Context) error {
+		if err := c.AppsV1().Deployments(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := c.CoreV1().Services(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+
+	if err := utils.WaitForDeployment(c, o.namespace, o.name, o.timeout); err != nil {
+		return h, fmt.Errorf("waiting for %s/%s: %w", o.namespace, o.name, err)
+	}
+	if err := utils.WaitForEndpointReady(c, o.namespace, o.name, o.timeout); err != nil {
+		return h, fmt.Errorf("waiting for %s/%s: %w", o.namespace, o.name, err)
+	}
+	return h, nil
+}
+
+// DeployProbePod deploys a pod to run DNS and connectivity checks from, with the "testsvc"
+// commands of bekind (like "/bekind testsvc dns kubernetes.default"), and waits for it to be
+// ready. The Handle is returned even if waiting fails so the pod can be cleaned up
+func DeployProbePod(ctx context.Context, cfg *rest.Config, opts ...Option) (*Handle, error) {
+	o := newOptions(DefaultProbeName, opts)
+	c, err := deploy(ctx, cfg, "manifests/probe.yaml", o)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHandle(o, func(ctx context.Context) error {
+		if err := c.CoreV1().Pods(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+
+	if err := utils.WaitForPod(c, o.namespace, o.name, o.timeout); err != nil {
+		return h, fmt.Errorf("waiting for %s/%s: %w", o.namespace, o.name, err)
+	}
+	return h, nil
+}
+
+// Verify deploys the echo server and the probe pod, checks cluster DNS, pod to service
+// traffic and port-forwarding with them, then cleans up. WithName is ignored
+func Verify(ctx context.Context, cfg *rest.Config, opts ...Option) ([]utils.ProbeResult, error) {
+	echo, err := DeployTestEcho(ctx, cfg, append(opts, WithName(DefaultEchoName))...)
+	if echo != nil {
+		defer echo.Cleanup(context.TODO())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	probe, err := DeployProbePod(ctx, cfg, append(opts, WithName(DefaultProbeName))...)
+	if probe != nil {
+		defer probe.Cleanup(context.TODO())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exec := func(args ...string) *utils.ExecProbe {
+		return &utils.ExecProbe{
+			Namespace: probe.Namespace,
+			Selector:  probe.Selector,
+			Command:   append([]string{"/bekind", "testsvc"}, args...),
+		}
+	}
+	service := fmt.Sprintf("%s.%s", echo.Name, echo.Namespace)
+	probes := []utils.Probe{
+		{Name: "cluster-dns", Retries: 5, Interval: 2 * time.Second, Exec: exec("dns", "kubernetes.default")},
+		{Name: "service-dns", Retries: 5, Interval: 2 * time.Second, Exec: exec("dns", service)},
+		{Name: "pod-to-service", Retries: 5, Interval: 2 * time.Second, Exec: exec("http", "http://"+service+"/")},
+		{Name: "port-forward", Retries: 5, Interval: 2 * time.Second, HTTP: &utils.HTTPProbe{
+			Namespace: echo.Namespace,
+			Service:   echo.Name,
+			Path:      "/healthz",
+		}},
+	}
+	return utils.RunProbes(ctx, cfg, probes), nil
+}
+
+// newOptions applies opts on top of the defaults
+func newOptions(name string, opts []Option) *options {
+	o := &options{
+		namespace:   DefaultNamespace,
+		name:        name,
+		clusterName: constants.DefaultClusterName,
+		timeout:     DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// The names end up as object names and label values
+	o.name = utils.SanitizeName(o.name)
+	o.namespace = utils.SanitizeName(o.namespace)
+	return o
+}
+
+// newHandle returns the Handle for what was deployed with o
+func newHandle(o *options, cleanup func(ctx context.Context) error) *Handle {
+	return &Handle{
+		Namespace: o.namespace,
+		Name:      o.name,
+		Selector:  "app.kubernetes.io/name=" + o.name,
+		cleanup:   cleanup,
+	}
+}
+
+// deploy renders the embedded manifest with o and applies it
+func deploy(ctx context.Context, cfg *rest.Config, manifest string, o *options) (kubernetes.Interface, error) {
+	image, err := ensureImage(o)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.ParseFS(manifests, manifest)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]string{
+		"Name":      o.name,
+		"Namespace": o.namespace,
+		"Image":     image,
+	})
+	if err != nil {
+		return nil, err
+	}
+	docs, err := utils.SplitYAML(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := utils.NewApplier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a.EnsureNamespaces = true
+	for _, doc := range docs {
+		if err := a.Apply(ctx, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return kubernetes.NewForConfig(cfg)
+}
+
+// built is the image of the running binary, it's only built once
+var (
+	buildOnce sync.Once
+	built     struct {
+		ref     string
+		archive []byte
+		err     error
+	}
+)
+
+// loaded remembers which clusters already have the image, keyed by cluster name and image
+var loaded sync.Map
+
+// ensureImage returns the image to run, building and loading it into the cluster if one wasn't given
+func ensureImage(o *options) (string, error) {
+	if o.image != "" {
+		return o.image, nil
+	}
+
+	buildOnce.Do(func() {
+		built.ref, built.archive, built.err = BuildImageArchive()
+	})
+	ref, archive, err := built.ref, built.archive, built.err
+	if err != nil {
+		return "", err
+	}
+	key := o.clusterName + "/" + ref
+	if _, ok := loaded.Load(key); ok {
+		return ref, nil
+	}
+
+	utils.GetLogger().Debug("loading test services image", "cluster", o.clusterName, "image", ref)
+	if err := cluster.LoadImageArchive(o.clusterName, archive); err != nil {
+		return "", err
+	}
+	loaded.Store(key, true)
+	return ref, nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultApplyDirRetries is how many extra passes ApplyDir makes for objects whose kind isn't known yet
+var DefaultApplyDirRetries int = 5
+
+// ApplyDirRetryInterval is how long ApplyDir waits between passes, giving CRDs time to be established
+var ApplyDirRetryInterval time.Duration = 2 * time.Second
+
+// manifest is a single YAML document and where it came from
+type manifest struct {
+	source string
+	index  int
+	doc    []byte
+}
+
+// ApplyDir applies every .yaml/.yml file under dir, in lexical order, using server side apply
+func ApplyDir(ctx context.Context, cfg *rest.Config, dir string) error {
+	a, err := NewApplier(cfg)
+	if err != nil {
+		return err
+	}
+	return a.ApplyDir(ctx, dir, DefaultApplyDirRetries)
+}
+
+// ApplyDir applies every .yaml/.yml file under dir, in lexical order. Objects whose kind
+// doesn't resolve yet (like a custom resource whose CRD was applied in an earlier file)
+// are retried in up to retries extra passes, resetting the discovery cache between them
+func (a *Applier) ApplyDir(ctx context.Context, dir string, retries int) error {
+	// WalkDir goes through the files in lexical order
+	var pending []manifest
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+		default:
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		docs, err := splitYAMLDocuments(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, d := range docs {
+			// Catch things like a values.yaml before anything gets applied
+			empty, err := checkDocument(path, d.index, d.doc)
+			if err != nil {
+				return err
+			}
+			if empty {
+				continue
+			}
+			pending = append(pending, manifest{source: path, index: d.index, doc: d.doc})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The passes below retry unknown kinds, so don't also back off on them for every object
+	once := *a
+	once.noMatchOnce = true
+
+	for pass := 0; ; pass++ {
+		var unresolved []manifest
+		var lastErr error
+		for _, m := range pending {
+			err := once.Apply(ctx, m.doc)
+			if meta.IsNoMatchError(err) {
+				unresolved = append(unresolved, m)
+				lastErr = fmt.Errorf("%s: document at index %d: %w", m.source, m.index, err)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: document at index %d: %w", m.source, m.index, err)
+			}
+		}
+
+		if len(unresolved) == 0 {
+			return nil
+		}
+		if pass >= retries {
+			return lastErr
+		}
+
+		// Give the new CRDs a bit of time and forget what discovery told us so far
+		a.log().Debug("retrying objects whose kind isn't known yet", "dir", dir, "pending", len(unresolved), "attempt", pass+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ApplyDirRetryInterval):
+		}
+		a.mapper.Reset()
+		pending = unresolved
+	}
+}
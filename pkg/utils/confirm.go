@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Destructive names an operation that has to be confirmed before it runs
+type Destructive string
+
+const (
+	// DestructiveTeardown confirms deleting clusters or the local registry
+	DestructiveTeardown Destructive = "teardown"
+	// DestructiveForceConflicts confirms taking over fields owned by other field managers
+	DestructiveForceConflicts Destructive = "force-conflicts"
+)
+
+// ErrConfirmationRequired is returned when a destructive operation wasn't confirmed
+type ErrConfirmationRequired struct {
+	Missing []Destructive
+}
+
+func (e *ErrConfirmationRequired) Error() string {
+	var missing []string
+	for _, m := range e.Missing {
+		missing = append(missing, string(m))
+	}
+	return fmt.Sprintf("confirmation required for destructive operation: %s", strings.Join(missing, ", "))
+}
+
+// RequireConfirmation returns an *ErrConfirmationRequired naming everything in needed that isn't in confirmed
+func RequireConfirmation(confirmed []Destructive, needed ...Destructive) error {
+	var missing []Destructive
+	for _, n := range needed {
+		found := false
+		for _, c := range confirmed {
+			if c == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, n)
+		}
+	}
+
+	if len(missing) != 0 {
+		return &ErrConfirmationRequired{Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Logger is what bekind logs through. Arguments after the message are key/value
+// pairs, so a *slog.Logger can be used as is
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = logrusLogger{}
+)
+
+// SetLogger replaces the package logger, the global logrus logger is used by default.
+// Passing nil silences all output
+func SetLogger(l Logger) {
+	if l == nil {
+		l = DiscardLogger{}
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// GetLogger returns the package logger
+func GetLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// DiscardLogger drops everything logged to it
+type DiscardLogger struct{}
+
+func (DiscardLogger) Debug(msg string, args ...any) {}
+func (DiscardLogger) Info(msg string, args ...any)  {}
+func (DiscardLogger) Warn(msg string, args ...any)  {}
+func (DiscardLogger) Error(msg string, args ...any) {}
+
+// logrusLogger sends everything to the global logrus logger, with the key/value pairs as fields
+type logrusLogger struct{}
+
+func (logrusLogger) Debug(msg string, args ...any) { log.WithFields(logrusFields(args)).Debug(msg) }
+func (logrusLogger) Info(msg string, args ...any)  { log.WithFields(logrusFields(args)).Info(msg) }
+func (logrusLogger) Warn(msg string, args ...any)  { log.WithFields(logrusFields(args)).Warn(msg) }
+func (logrusLogger) Error(msg string, args ...any) { log.WithFields(logrusFields(args)).Error(msg) }
+
+// logrusFields turns key/value pairs into logrus fields. A key without a value is kept as "!BADKEY"
+func logrusFields(args []any) log.Fields {
+	fields := log.Fields{}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fields["!BADKEY"] = args[i]
+			break
+		}
+		fields[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return fields
+}
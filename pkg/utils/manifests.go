@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	goyaml "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ManifestError is returned when a document in a manifest isn't a Kubernetes object
+type ManifestError struct {
+	// Source is the file path or URL the document came from
+	Source string
+	// Index is the position of the document in the source, starting at 0. Blank documents count too
+	Index int
+	// Keys are the top-level keys found in the document
+	Keys []string
+	// Reason says what's wrong with the document
+	Reason string
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("%s: document at index %d is not a Kubernetes object (%s), found top-level keys [%s]",
+		e.Source, e.Index, e.Reason, strings.Join(e.Keys, ", "))
+}
+
+// LoadManifests reads the manifests from a file path or an http(s) URL and parses them with ParseManifests
+func LoadManifests(source string, skipInvalid bool) ([]*unstructured.Unstructured, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		s, err := DownloadFileString(source)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(s)
+	} else {
+		b, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	return ParseManifests(source, data, skipInvalid)
+}
+
+// ParseManifests splits a multipart YAML into objects. The source (a file path or URL) is only
+// used for error messages. Documents without an apiVersion or kind return a *ManifestError,
+// unless skipInvalid is set in which case they are skipped. Empty documents are always skipped
+func ParseManifests(source string, manifests []byte, skipInvalid bool) ([]*unstructured.Unstructured, error) {
+	docs, err := splitYAMLDocuments(bytes.NewReader(manifests))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, d := range docs {
+		empty, err := checkDocument(source, d.index, d.doc)
+		var merr *ManifestError
+		if errors.As(err, &merr) && skipInvalid {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Nothing in this document
+		if empty {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if _, _, err := decUnstructured.Decode(d.doc, nil, obj); err != nil {
+			return nil, fmt.Errorf("%s: document at index %d: %w", source, d.index, err)
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// checkDocument tells if the document is empty, and returns a *ManifestError if it has
+// something in it that isn't a Kubernetes object
+func checkDocument(source string, index int, doc []byte) (bool, error) {
+	var value interface{}
+	if err := goyaml.Unmarshal(doc, &value); err != nil {
+		return false, fmt.Errorf("%s: document at index %d: %w", source, index, err)
+	}
+	if value == nil {
+		return true, nil
+	}
+
+	if merr := checkManifest(source, index, value); merr != nil {
+		return false, merr
+	}
+	return false, nil
+}
+
+// checkManifest makes sure the document looks like a Kubernetes object before it hits the decoder
+func checkManifest(source string, index int, value interface{}) *ManifestError {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return &ManifestError{
+			Source: source,
+			Index:  index,
+			Reason: fmt.Sprintf("expected a mapping, got %T", value),
+		}
+	}
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	sort.Strings(keys)
+
+	var missing []string
+	for _, field := range []string{"apiVersion", "kind"} {
+		if v, ok := m[field].(string); !ok || v == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return &ManifestError{
+		Source: source,
+		Index:  index,
+		Keys:   keys,
+		Reason: "missing " + strings.Join(missing, " and "),
+	}
+}
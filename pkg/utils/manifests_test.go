@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+
+func TestParseManifestsNotKubernetes(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		index  int
+		keys   []string
+		reason string
+	}{
+		{
+			name: "values.yaml",
+			input: `replicaCount: 1
+image:
+  repository: nginx
+  tag: ""
+service:
+  type: ClusterIP
+  port: 80
+`,
+			keys:   []string{"image", "replicaCount", "service"},
+			reason: "missing apiVersion and kind",
+		},
+		{
+			name: "docker-compose",
+			input: `version: "3.9"
+services:
+  web:
+    image: nginx
+    ports:
+      - "8080:80"
+`,
+			keys:   []string{"services", "version"},
+			reason: "missing apiVersion and kind",
+		},
+		{
+			name:   "empty mapping",
+			input:  "{}\n",
+			reason: "missing apiVersion and kind",
+		},
+		{
+			name:   "missing kind",
+			input:  "apiVersion: v1\nmetadata:\n  name: test\n",
+			keys:   []string{"apiVersion", "metadata"},
+			reason: "missing kind",
+		},
+		{
+			name:   "index counts blank documents",
+			input:  configMap + "---\n---\nfoo: bar\n",
+			index:  2,
+			keys:   []string{"foo"},
+			reason: "missing apiVersion and kind",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifests("test.yaml", []byte(tt.input), false)
+
+			var merr *ManifestError
+			if !errors.As(err, &merr) {
+				t.Fatalf("expected a *ManifestError, got %v", err)
+			}
+			if merr.Source != "test.yaml" {
+				t.Errorf("Source = %q, want %q", merr.Source, "test.yaml")
+			}
+			if merr.Index != tt.index {
+				t.Errorf("Index = %d, want %d", merr.Index, tt.index)
+			}
+			if !reflect.DeepEqual(merr.Keys, tt.keys) {
+				t.Errorf("Keys = %v, want %v", merr.Keys, tt.keys)
+			}
+			if merr.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", merr.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseManifestsSkipInvalid(t *testing.T) {
+	input := "replicaCount: 1\n---\n" + configMap + "---\n{}\n"
+
+	objs, err := ParseManifests("test.yaml", []byte(input), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetKind() != "ConfigMap" {
+		t.Fatalf("expected only the ConfigMap, got %v", objs)
+	}
+}
+
+func TestApplyDirNotKubernetes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "00-configmap.yaml"), []byte(configMap), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "values.yaml"), []byte(configMap+"---\nreplicaCount: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The check happens before anything is applied, so no cluster is needed
+	err := (&Applier{}).ApplyDir(context.Background(), dir, 0)
+
+	var merr *ManifestError
+	if !errors.As(err, &merr) {
+		t.Fatalf("expected a *ManifestError, got %v", err)
+	}
+	if merr.Source != filepath.Join(dir, "values.yaml") || merr.Index != 1 {
+		t.Errorf("got %s index %d, want %s index 1", merr.Source, merr.Index, filepath.Join(dir, "values.yaml"))
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the longest an RFC 1123 label can be
+const MaxNameLength = 63
+
+// MaxClusterNameLength leaves room in MaxNameLength for the node suffixes KIND adds, like "-control-plane3"
+const MaxClusterNameLength = MaxNameLength - len("-control-plane3")
+
+// nameHashLength is how many hex characters of the hash SanitizeName keeps when it truncates
+const nameHashLength = 8
+
+// ErrInvalidName is returned when a name isn't a valid RFC 1123 label
+type ErrInvalidName struct {
+	// What is what the name is for, like "cluster name"
+	What   string
+	Name   string
+	Reason string
+	// Index is where the offending character is, counted in characters (not bytes).
+	// It's -1 if it's about the whole name
+	Index int
+}
+
+func (e *ErrInvalidName) Error() string {
+	runes := []rune(e.Name)
+	if e.Index < 0 || e.Index >= len(runes) {
+		return fmt.Sprintf("invalid %s %q: %s", e.What, e.Name, e.Reason)
+	}
+	// Point out the character, like my[_]cluster
+	highlighted := string(runes[:e.Index]) + "[" + string(runes[e.Index]) + "]" + string(runes[e.Index+1:])
+	return fmt.Sprintf("invalid %s %q at position %d (%s): %s", e.What, e.Name, e.Index, highlighted, e.Reason)
+}
+
+// ValidateClusterName checks the name is safe to use for a KIND cluster, its node containers,
+// network, kubeconfig context and any labels derived from it
+func ValidateClusterName(name string) error {
+	return validateName("cluster name", name, MaxClusterNameLength)
+}
+
+// ValidateName checks the name is an RFC 1123 label: lowercase letters, digits and '-',
+// starting and ending with a letter or digit, at most MaxNameLength long
+func ValidateName(name string) error {
+	return validateName("name", name, MaxNameLength)
+}
+
+// validateName checks name is an RFC 1123 label no longer than max
+func validateName(what string, name string, max int) error {
+	if name == "" {
+		return &ErrInvalidName{What: what, Name: name, Reason: "can't be empty", Index: -1}
+	}
+	if len(name) > max {
+		return &ErrInvalidName{What: what, Name: name, Reason: fmt.Sprintf("is %d characters long, the limit is %d", len(name), max), Index: -1}
+	}
+
+	runes := []rune(name)
+	for i, c := range runes {
+		switch {
+		case c < utf8.RuneSelf && isNameChar(byte(c)):
+		case c == '-' && (i == 0 || i == len(runes)-1):
+			return &ErrInvalidName{What: what, Name: name, Reason: "has to start and end with a lowercase letter or digit", Index: i}
+		case c == '-':
+		case c >= 'A' && c <= 'Z':
+			return &ErrInvalidName{What: what, Name: name, Reason: fmt.Sprintf("uppercase %q isn't allowed", c), Index: i}
+		default:
+			return &ErrInvalidName{What: what, Name: name, Reason: fmt.Sprintf("%q isn't allowed, only lowercase letters, digits and '-' are", c), Index: i}
+		}
+	}
+	return nil
+}
+
+// SanitizeName turns s into an RFC 1123 label. Uppercase is lowered and runs of anything else
+// that isn't allowed become a single '-'. Names longer than MaxNameLength are truncated and
+// end in a hash of s, so the same input always gives the same name and long names stay distinct
+func SanitizeName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range []byte(strings.ToLower(s)) {
+		if isNameChar(c) {
+			b.WriteByte(c)
+			dash = false
+			continue
+		}
+		if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.Trim(b.String(), "-")
+
+	if name == "" {
+		return "x-" + nameHash(s)
+	}
+	if len(name) <= MaxNameLength {
+		return name
+	}
+
+	// if we are here, the name is too long
+	name = strings.TrimRight(name[:MaxNameLength-nameHashLength-1], "-")
+	return name + "-" + nameHash(s)
+}
+
+// isNameChar checks to see if c is a lowercase letter or digit
+func isNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// nameHash returns the start of the hex SHA-256 of s
+func nameHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:nameHashLength]
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateClusterName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "kind"},
+		{name: "dev-1"},
+		{name: strings.Repeat("a", MaxClusterNameLength)},
+		{name: "", want: `invalid cluster name "": can't be empty`},
+		{name: "my_cluster", want: `invalid cluster name "my_cluster" at position 2 (my[_]cluster): '_' isn't allowed, only lowercase letters, digits and '-' are`},
+		{name: "Dev", want: `invalid cluster name "Dev" at position 0 ([D]ev): uppercase 'D' isn't allowed`},
+		{name: "dev-", want: `invalid cluster name "dev-" at position 3 (dev[-]): has to start and end with a lowercase letter or digit`},
+		{name: "café", want: `invalid cluster name "café" at position 3 (caf[é]): 'é' isn't allowed, only lowercase letters, digits and '-' are`},
+		{name: "ünï", want: `invalid cluster name "ünï" at position 0 ([ü]nï): 'ü' isn't allowed, only lowercase letters, digits and '-' are`},
+		{
+			name: strings.Repeat("a", MaxClusterNameLength+1),
+			want: `invalid cluster name "` + strings.Repeat("a", MaxClusterNameLength+1) + `": is 49 characters long, the limit is 48`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClusterName(tt.name)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var nerr *ErrInvalidName
+			if !errors.As(err, &nerr) {
+				t.Fatalf("expected an *ErrInvalidName, got %v", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got  %s\nwant %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	long := strings.Repeat("ab_", 40)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "kind-registry", want: "kind-registry"},
+		{in: "My_Bundle.v2", want: "my-bundle-v2"},
+		{in: "--a__b--", want: "a-b"},
+		{in: "café", want: "caf"},
+		{in: long, want: strings.TrimSuffix(strings.Repeat("ab-", 18), "-") + "-" + nameHash(long)},
+		{in: "__", want: "x-" + nameHash("__")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := SanitizeName(tt.in)
+			if got != tt.want {
+				t.Errorf("SanitizeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if err := ValidateName(got); err != nil {
+				t.Errorf("SanitizeName(%q) isn't valid: %v", tt.in, err)
+			}
+			if again := SanitizeName(tt.in); again != got {
+				t.Errorf("SanitizeName(%q) isn't deterministic: %q then %q", tt.in, got, again)
+			}
+		})
+	}
+
+	// Long names that only differ at the end still get different names
+	a, b := SanitizeName(strings.Repeat("a", 80)+"1"), SanitizeName(strings.Repeat("a", 80)+"2")
+	if a == b || len(a) > MaxNameLength {
+		t.Errorf("expected distinct names of at most %d characters, got %q and %q", MaxNameLength, a, b)
+	}
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards localPort on 127.0.0.1 to remotePort until ctx is cancelled. The target
+// can be a pod ("name" or "pod/name") or a service ("svc/name" or "service/name"). For a
+// service, remotePort is the service port and a ready pod behind it is picked. A plain
+// name that isn't a pod is tried as a service. A localPort of 0 picks any free port.
+// It returns the bound local port and a channel that gets the error (or nil) the
+// forwarder stopped with
+func PortForward(ctx context.Context, cfg *rest.Config, namespace string, podOrServiceName string, localPort int, remotePort int) (int, <-chan error, error) {
+	c, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	kind, name := "", podOrServiceName
+	if i := strings.Index(podOrServiceName, "/"); i >= 0 {
+		kind, name = podOrServiceName[:i], podOrServiceName[i+1:]
+	}
+
+	switch kind {
+	case "pod", "pods", "po":
+	case "svc", "service", "services":
+		return forwardService(ctx, cfg, c, namespace, name, localPort, remotePort)
+	case "":
+		_, err := c.CoreV1().Pods(namespace).Get(ctx, name, v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return forwardService(ctx, cfg, c, namespace, name, localPort, remotePort)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("can't port-forward to %q, only pods and services are supported", kind)
+	}
+
+	return forwardPort(ctx, cfg, namespace, name, localPort, remotePort)
+}
+
+// forwardService forwards to a ready pod behind the service
+func forwardService(ctx context.Context, cfg *rest.Config, c kubernetes.Interface, namespace string, service string, localPort int, servicePort int) (int, <-chan error, error) {
+	pod, target, err := readyPodForService(ctx, c, namespace, service, servicePort)
+	if err != nil {
+		return 0, nil, err
+	}
+	return forwardPort(ctx, cfg, namespace, pod, localPort, target)
+}
+
+// forwardPort forwards localPort on 127.0.0.1 to remotePort on the pod until ctx is cancelled.
+// A localPort of 0 picks any free port. It returns the bound local port and a channel
+// that gets the error (or nil) the forwarder stopped with
+func forwardPort(ctx context.Context, cfg *rest.Config, namespace string, pod string, localPort int, remotePort int) (int, <-chan error, error) {
+	c, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"},
+		[]string{fmt.Sprintf("%d:%d", localPort, remotePort)}, stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fw.ForwardPorts()
+	}()
+
+	// Tear down the forwarder when the context is done
+	go func() {
+		<-ctx.Done()
+		close(stopCh)
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		if err == nil {
+			err = fmt.Errorf("port-forward to %s/%s stopped before it was ready", namespace, pod)
+		}
+		return 0, nil, err
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ports) == 0 {
+		return 0, nil, fmt.Errorf("port-forward to %s/%s has no ports", namespace, pod)
+	}
+
+	return int(ports[0].Local), errCh, nil
+}
+
+// readyPodForService returns a ready pod behind the service and the container port
+// the given service port maps to on that pod
+func readyPodForService(ctx context.Context, c kubernetes.Interface, namespace string, service string, port int) (string, int, error) {
+	svc, err := c.CoreV1().Services(namespace).Get(ctx, service, v1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s/%s has no selector", namespace, service)
+	}
+
+	// Find the service port, the first one is used if none was given
+	var svcPort *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if port == 0 || int(svc.Spec.Ports[i].Port) == port {
+			svcPort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if svcPort == nil {
+		return "", 0, fmt.Errorf("service %s/%s has no port %d", namespace, service, port)
+	}
+
+	pods, err := c.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, p := range pods.Items {
+		if !isPodReady(&p) {
+			continue
+		}
+		target, ok := resolveTargetPort(&p, svcPort)
+		if !ok {
+			continue
+		}
+		return p.Name, target, nil
+	}
+
+	return "", 0, fmt.Errorf("no ready pods found for service %s/%s", namespace, service)
+}
+
+// resolveTargetPort maps the service's target port to a port number on the pod
+func resolveTargetPort(pod *corev1.Pod, svcPort *corev1.ServicePort) (int, bool) {
+	switch svcPort.TargetPort.Type {
+	case intstr.Int:
+		if svcPort.TargetPort.IntVal == 0 {
+			return int(svcPort.Port), true
+		}
+		return int(svcPort.TargetPort.IntVal), true
+	case intstr.String:
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == svcPort.TargetPort.StrVal {
+					return int(p.ContainerPort), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// isPodReady checks to see if the pod is running with the Ready condition set
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
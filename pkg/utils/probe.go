@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Probe is an application level readiness check. Exactly one of HTTP or Exec should be set
+type Probe struct {
+	Name string
+	HTTP *HTTPProbe
+	Exec *ExecProbe
+	// Retries is how many times the probe is attempted, defaults to 1
+	Retries int
+	// Interval is the time between attempts, defaults to 5 seconds
+	Interval time.Duration
+	// Timeout is the time allowed for a single attempt, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// HTTPProbe does a GET through a port-forward to a ready pod behind the named Service
+type HTTPProbe struct {
+	Namespace string
+	Service   string
+	// Port is the service port, the first one is used if not set
+	Port int
+	Path string
+	// Status is the expected HTTP status code, defaults to 200
+	Status int
+}
+
+// ExecProbe runs a command in the first ready pod matching the label selector.
+// The probe passes when the command exits 0
+type ExecProbe struct {
+	Namespace string
+	Selector  string
+	Container string
+	Command   []string
+}
+
+// ProbeResult is the outcome of running a Probe
+type ProbeResult struct {
+	Name     string
+	Passed   bool
+	Attempts int
+	// Output is the response body or command output of the last attempt
+	Output string
+	Err    error
+}
+
+// RunProbes runs every probe in order and returns their results
+func RunProbes(ctx context.Context, cfg *rest.Config, probes []Probe) []ProbeResult {
+	var results []ProbeResult
+	for _, p := range probes {
+		results = append(results, RunProbe(ctx, cfg, p))
+	}
+	return results
+}
+
+// RunProbe runs the probe until it passes or it runs out of retries
+func RunProbe(ctx context.Context, cfg *rest.Config, p Probe) ProbeResult {
+	res := ProbeResult{Name: p.Name}
+
+	retries := p.Retries
+	if retries < 1 {
+		retries = 1
+	}
+	interval := p.Interval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	c, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	for res.Attempts < retries {
+		res.Attempts++
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		switch {
+		case p.HTTP != nil && p.Exec == nil:
+			res.Output, res.Err = runHTTPProbe(attemptCtx, cfg, c, p.HTTP)
+		case p.Exec != nil && p.HTTP == nil:
+			res.Output, res.Err = runExecProbe(attemptCtx, cfg, c, p.Exec)
+		default:
+			cancel()
+			res.Err = fmt.Errorf("probe %q needs exactly one of http or exec", p.Name)
+			return res
+		}
+		cancel()
+
+		if res.Err == nil {
+			res.Passed = true
+			return res
+		}
+
+		// Wait before trying again, unless this was the last attempt
+		if res.Attempts < retries {
+			select {
+			case <-ctx.Done():
+				res.Err = ctx.Err()
+				return res
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	return res
+}
+
+// runHTTPProbe port-forwards to the service and returns the response body
+func runHTTPProbe(ctx context.Context, cfg *rest.Config, c kubernetes.Interface, p *HTTPProbe) (string, error) {
+	fwdCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	local, _, err := forwardService(fwdCtx, cfg, c, p.Namespace, p.Service, 0, p.Port)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/%s", local, strings.TrimPrefix(p.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	status := p.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.StatusCode != status {
+		return string(body), fmt.Errorf("GET %s/%s%s returned %d, expected %d", p.Namespace, p.Service, p.Path, resp.StatusCode, status)
+	}
+
+	return string(body), nil
+}
+
+// runExecProbe runs the command in a ready pod and returns its combined output
+func runExecProbe(ctx context.Context, cfg *rest.Config, c kubernetes.Interface, p *ExecProbe) (string, error) {
+	if len(p.Command) == 0 {
+		return "", errors.New("exec probe has no command")
+	}
+
+	pods, err := c.CoreV1().Pods(p.Namespace).List(ctx, v1.ListOptions{LabelSelector: p.Selector})
+	if err != nil {
+		return "", err
+	}
+
+	var pod *corev1.Pod
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			pod = &pods.Items[i]
+			break
+		}
+	}
+	if pod == nil {
+		return "", fmt.Errorf("no ready pods found in %s matching %q", p.Namespace, p.Selector)
+	}
+
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: p.Container,
+			Command:   p.Command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(cfg, http.MethodPost, req.URL())
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &out,
+		Stderr: &out,
+	})
+	if err != nil {
+		return out.String(), fmt.Errorf("exec in %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	memory "k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderOptions configures RenderBundle
+type RenderOptions struct {
+	// Namespace is set on namespaced objects that don't have one. Telling if a kind
+	// is namespaced is the only thing rendering needs discovery for. It's passed through SanitizeName
+	Namespace string
+	// Mapper answers the discovery questions
+	Mapper meta.RESTMapper
+	// Snapshot is a pinned discovery snapshot used when no Mapper is given, so
+	// rendering works fully offline
+	Snapshot *Snapshot
+	// SnapshotMaxAge is how old the Snapshot can be before warning about it,
+	// DefaultSnapshotMaxAge is used if it's 0
+	SnapshotMaxAge time.Duration
+	// Config is used for discovery against a live cluster when there's no Mapper or Snapshot
+	Config *rest.Config
+}
+
+// RenderBundle returns the documents as a single multi-document YAML, in the order they
+// would be applied. The output is normalized so it's the same between runs: keys are
+// sorted, documents that aren't Kubernetes objects are an error and empty ones are dropped.
+// Nothing is sent to the cluster
+func RenderBundle(ctx context.Context, docs [][]byte, opts RenderOptions) ([]byte, error) {
+	if opts.Namespace != "" {
+		opts.Namespace = SanitizeName(opts.Namespace)
+	}
+
+	mapper := opts.Mapper
+	if mapper == nil && opts.Snapshot != nil {
+		opts.Snapshot.CheckAge(opts.SnapshotMaxAge)
+		mapper = opts.Snapshot.RESTMapper()
+	}
+	if mapper == nil && opts.Namespace != "" {
+		if opts.Config == nil {
+			return nil, errors.New("setting a namespace needs a Mapper, Snapshot or Config for discovery")
+		}
+		dc, err := discovery.NewDiscoveryClientForConfig(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+		mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	}
+
+	var out bytes.Buffer
+	for i, doc := range docs {
+		objs, err := ParseManifests(fmt.Sprintf("bundle[%d]", i), doc, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			// Default the namespace of namespaced objects
+			if opts.Namespace != "" && obj.GetNamespace() == "" {
+				gvk := obj.GroupVersionKind()
+				mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", gvk.Kind, obj.GetName(), err)
+				}
+				if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+					obj.SetNamespace(opts.Namespace)
+				}
+			}
+
+			// Marshaling through JSON sorts the keys
+			b, err := yaml.Marshal(obj.Object)
+			if err != nil {
+				return nil, err
+			}
+
+			out.WriteString("---\n")
+			out.Write(b)
+		}
+	}
+
+	return out.Bytes(), nil
+}
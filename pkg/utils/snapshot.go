@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// DefaultSnapshotMaxAge is how old a discovery snapshot can get before consumers warn about it
+var DefaultSnapshotMaxAge time.Duration = 7 * 24 * time.Hour
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// Snapshot is the discovery data of a cluster, so it can be used without one
+type Snapshot struct {
+	// ServerVersion is the Kubernetes version of the cluster the snapshot was taken from
+	ServerVersion string `json:"serverVersion"`
+	// Timestamp is when the snapshot was taken
+	Timestamp  time.Time       `json:"timestamp"`
+	Groups     []SnapshotGroup `json:"groups"`
+	CRDSchemas []CRDSchema     `json:"crdSchemas,omitempty"`
+}
+
+// SnapshotGroup is an API group and its resources for each version
+type SnapshotGroup struct {
+	Group              v1.APIGroup                 `json:"group"`
+	VersionedResources map[string][]v1.APIResource `json:"versionedResources"`
+}
+
+// CRDSchema is the OpenAPI schema of one version of a CustomResourceDefinition
+type CRDSchema struct {
+	Group   string                 `json:"group"`
+	Version string                 `json:"version"`
+	Kind    string                 `json:"kind"`
+	Schema  map[string]interface{} `json:"schema,omitempty"`
+}
+
+// ExportDiscoverySnapshot captures the API groups, versions, resources and CRD schemas of the cluster
+func ExportDiscoverySnapshot(ctx context.Context, cfg *rest.Config) (*Snapshot, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := dc.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// Aggregated APIs like metrics.k8s.io are often not up yet after bring-up,
+	// so keep whatever did come back and leave the failed ones out
+	groups, resources, err := dc.ServerGroupsAndResources()
+	if err != nil {
+		failed, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+		if !ok || groups == nil {
+			return nil, err
+		}
+		for gv, gerr := range failed.Groups {
+			GetLogger().Warn("leaving API group out of the discovery snapshot", "groupVersion", gv.String(), "error", gerr)
+		}
+	}
+
+	byGroupVersion := map[string]*v1.APIResourceList{}
+	for _, r := range resources {
+		byGroupVersion[r.GroupVersion] = r
+	}
+
+	s := &Snapshot{
+		ServerVersion: version.GitVersion,
+		Timestamp:     time.Now().UTC(),
+	}
+	for _, g := range groups {
+		versioned := map[string][]v1.APIResource{}
+		for _, v := range g.Versions {
+			if r, ok := byGroupVersion[v.GroupVersion]; ok {
+				versioned[v.Version] = r.APIResources
+			}
+		}
+		if len(versioned) == 0 {
+			continue
+		}
+		s.Groups = append(s.Groups, SnapshotGroup{
+			Group:              *g,
+			VersionedResources: versioned,
+		})
+	}
+
+	// Grab the CRD schemas too
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	crds, err := dyn.Resource(crdResource).List(ctx, v1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, crd := range crds.Items {
+		s.CRDSchemas = append(s.CRDSchemas, crdSchemas(&crd)...)
+	}
+
+	return s, nil
+}
+
+// LoadDiscoverySnapshot reads a snapshot written with Save
+func LoadDiscoverySnapshot(path string) (*Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the snapshot to path as JSON
+func (s *Snapshot) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// RESTMapper returns a RESTMapper that answers from the snapshot
+func (s *Snapshot) RESTMapper() meta.RESTMapper {
+	var groups []*restmapper.APIGroupResources
+	for _, g := range s.Groups {
+		groups = append(groups, &restmapper.APIGroupResources{
+			Group:              g.Group,
+			VersionedResources: g.VersionedResources,
+		})
+	}
+	return restmapper.NewDiscoveryRESTMapper(groups)
+}
+
+// CheckAge warns if the snapshot is older than maxAge, DefaultSnapshotMaxAge is used if maxAge is 0
+func (s *Snapshot) CheckAge(maxAge time.Duration) bool {
+	if maxAge == 0 {
+		maxAge = DefaultSnapshotMaxAge
+	}
+
+	age := time.Since(s.Timestamp)
+	if age <= maxAge {
+		return true
+	}
+
+	GetLogger().Warn("discovery snapshot is older than the max age", "serverVersion", s.ServerVersion,
+		"age", age.Round(time.Second).String(), "maxAge", maxAge.String())
+	return false
+}
+
+// crdSchemas returns the schema of every version of the CRD
+func crdSchemas(crd *unstructured.Unstructured) []CRDSchema {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	var schemas []CRDSchema
+	for _, v := range versions {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(m, "name")
+		openAPI, _, _ := unstructured.NestedMap(m, "schema", "openAPIV3Schema")
+		schemas = append(schemas, CRDSchema{
+			Group:   group,
+			Version: name,
+			Kind:    kind,
+			Schema:  openAPI,
+		})
+	}
+	return schemas
+}
@@ -1,21 +1,25 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
 	"time"
 
-	log "github.com/sirupsen/logrus"
-	goyaml "gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -26,6 +30,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/kind/pkg/cluster"
 )
 
@@ -33,78 +38,365 @@ var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONSc
 
 // GetDefault selected the default runtime from the environment override
 func GetDefaultRuntime() cluster.ProviderOption {
-	switch p := os.Getenv("KIND_EXPERIMENTAL_PROVIDER"); p {
-	case "":
+	p := os.Getenv("KIND_EXPERIMENTAL_PROVIDER")
+	opt, err := RuntimeFromString(p)
+	if err != nil {
+		GetLogger().Warn("ignoring unknown value for KIND_EXPERIMENTAL_PROVIDER", "provider", p)
 		return nil
+	}
+	if opt != nil {
+		GetLogger().Warn("using provider due to KIND_EXPERIMENTAL_PROVIDER", "provider", p)
+	}
+	return opt
+}
+
+// RuntimeFromString returns the ProviderOption for the named runtime. An empty
+// name returns nil, which lets KIND pick the runtime itself
+func RuntimeFromString(name string) (cluster.ProviderOption, error) {
+	switch name {
+	case "":
+		return nil, nil
 	case "podman":
-		log.Warn("using podman due to KIND_EXPERIMENTAL_PROVIDER")
-		return cluster.ProviderWithPodman()
+		return cluster.ProviderWithPodman(), nil
 	case "docker":
-		log.Warn("using docker due to KIND_EXPERIMENTAL_PROVIDER")
-		return cluster.ProviderWithDocker()
+		return cluster.ProviderWithDocker(), nil
 	default:
-		log.Warnf("ignoring unknown value %q for KIND_EXPERIMENTAL_PROVIDER", p)
-		return nil
+		return nil, fmt.Errorf("unknown provider %q, expected \"docker\" or \"podman\"", name)
 	}
 }
 
-// DoSSA  does service side apply with the given YAML as a []byte
-func DoSSA(ctx context.Context, cfg *rest.Config, yaml []byte) error {
-	// Read yaml into a slice of byte
-	yml := yaml
+// Applier does server side apply using a RESTMapper and dynamic client that
+// are built once, so it can be reused across many objects
+type Applier struct {
+	// EnsureNamespaces creates the namespace of namespaced objects if it doesn't exist yet
+	EnsureNamespaces bool
+	// Backoff is used to retry transient errors, DefaultApplyBackoff is used if nil
+	Backoff *wait.Backoff
+	// Logger gets the progress events, the package logger is used if nil
+	Logger Logger
+
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+	dyn    dynamic.Interface
+	client kubernetes.Interface
+	// noMatchOnce gives unknown kinds a single attempt, for callers that retry those themselves
+	noMatchOnce bool
+}
 
+// NewApplier returns an Applier for the given *rest.Config
+func NewApplier(cfg *rest.Config) (*Applier, error) {
 	// get the RESTMapper for the GVR
 	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
 
 	// create dymanic client
 	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// read YAML manifest into unstructured.Unstructured
-	obj := &unstructured.Unstructured{}
-	_, gvk, err := decUnstructured.Decode(yml, nil, obj)
+	// create typed client
+	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Get the GVR
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return &Applier{mapper: mapper, dyn: dyn, client: client}, nil
+}
+
+// DefaultApplyBackoff is how transient errors are retried during server side apply
+var DefaultApplyBackoff wait.Backoff = wait.Backoff{
+	Steps:    5,
+	Duration: 500 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// DefaultFieldManager is the field manager used when none is given
+var DefaultFieldManager string = "fauxpenshift"
+
+// SSAOptions configures a single server side apply
+type SSAOptions struct {
+	// FieldManager is the field owner ID, DefaultFieldManager is used if empty
+	FieldManager string
+	// DryRun returns what the server would produce without persisting anything
+	DryRun bool
+	// Force takes over fields owned by other field managers instead of failing with a conflict.
+	// It needs DestructiveForceConflicts in Confirm
+	Force bool
+	// Confirm acknowledges the destructive parts of the apply
+	Confirm []Destructive
+}
+
+// Operation is what server side apply did to an object
+type Operation string
+
+const (
+	OperationCreated    Operation = "created"
+	OperationConfigured Operation = "configured"
+	OperationUnchanged  Operation = "unchanged"
+)
+
+// ApplyResult describes an object after server side apply
+type ApplyResult struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Operation Operation
+	DryRun    bool
+	// Object is what the server returned
+	Object *unstructured.Unstructured
+}
+
+// String returns a kubectl style summary like "deployment.apps/foo configured"
+func (r *ApplyResult) String() string {
+	kind := strings.ToLower(r.GVK.Kind)
+	if r.GVK.Group != "" {
+		kind = kind + "." + r.GVK.Group
+	}
+	s := fmt.Sprintf("%s/%s %s", kind, r.Name, r.Operation)
+	if r.DryRun {
+		s += " (server dry run)"
+	}
+	return s
+}
+
+// log returns the logger for the Applier
+func (a *Applier) log() Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+	return GetLogger()
+}
+
+// Apply does server side apply with the given YAML as a []byte
+func (a *Applier) Apply(ctx context.Context, yaml []byte) error {
+	_, err := a.apply(ctx, yaml, SSAOptions{}, false)
+	return err
+}
+
+// ApplyDryRun does a server side apply dry-run and returns the object the server would produce
+func (a *Applier) ApplyDryRun(ctx context.Context, yaml []byte) (*unstructured.Unstructured, error) {
+	res, err := a.apply(ctx, yaml, SSAOptions{DryRun: true}, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return res.Object, nil
+}
 
-	// Get the REST interface for the GVR
-	var dr dynamic.ResourceInterface
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		// namespaced resources should specify the namespace
-		dr = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
-	} else {
-		// for cluster-wide resources
-		dr = dyn.Resource(mapping.Resource)
+// ApplyWithResult does server side apply and reports if the object was created, configured or left unchanged
+func (a *Applier) ApplyWithResult(ctx context.Context, yaml []byte, opts SSAOptions) (*ApplyResult, error) {
+	return a.apply(ctx, yaml, opts, true)
+}
+
+// apply does the server side apply. The live object is only looked up when withResult is set
+func (a *Applier) apply(ctx context.Context, yaml []byte, opts SSAOptions, withResult bool) (*ApplyResult, error) {
+	if opts.Force {
+		if err := RequireConfirmation(opts.Confirm, DestructiveForceConflicts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Make sure it's a Kubernetes object before the decoder gets to it
+	if _, err := checkDocument("manifest", 0, yaml); err != nil {
+		return nil, err
+	}
+
+	// read YAML manifest into unstructured.Unstructured
+	obj := &unstructured.Unstructured{}
+	_, gvk, err := decUnstructured.Decode(yaml, nil, obj)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create object into JSON
 	data, err := json.Marshal(obj)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create or Update the obj with service side apply
 	//     types.ApplyPatchType indicates service side apply
 	//     FieldManager specifies the field owner ID.
-	_, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, v1.PatchOptions{
-		FieldManager: "fauxpenshift",
+	patchOpts := v1.PatchOptions{
+		FieldManager: opts.FieldManager,
+	}
+	if patchOpts.FieldManager == "" {
+		patchOpts.FieldManager = DefaultFieldManager
+	}
+	if opts.DryRun {
+		patchOpts.DryRun = []string{v1.DryRunAll}
+	}
+	if opts.Force {
+		patchOpts.Force = &opts.Force
+	}
+
+	backoff := DefaultApplyBackoff
+	if a.Backoff != nil {
+		backoff = *a.Backoff
+	}
+
+	// The API server (and new CRDs or webhooks) might not be ready yet, so retry transient errors
+	var live, out *unstructured.Unstructured
+	attempt := 0
+	retriable := isRetriableApplyError
+	if a.noMatchOnce {
+		retriable = func(err error) bool {
+			return !meta.IsNoMatchError(err) && isRetriableApplyError(err)
+		}
+	}
+	err = retry.OnError(backoff, retriable, func() error {
+		attempt++
+		if attempt > 1 {
+			a.log().Debug("retrying apply", "gvk", gvk.String(), "namespace", obj.GetNamespace(), "name", obj.GetName(), "attempt", attempt)
+		}
+
+		// Get the GVR
+		mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			// discovery might not have caught up yet, so forget what it told us
+			if meta.IsNoMatchError(err) {
+				a.log().Debug("kind not found, resetting discovery", "gvk", gvk.String(), "namespace", obj.GetNamespace(), "name", obj.GetName(), "attempt", attempt)
+				a.mapper.Reset()
+			}
+			return err
+		}
+
+		// Get the REST interface for the GVR
+		var dr dynamic.ResourceInterface
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			// namespaced resources should specify the namespace
+			dr = a.dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+
+			// the namespace might come later in the manifests, so create it now if asked to
+			if ns := obj.GetNamespace(); a.EnsureNamespaces && !opts.DryRun && ns != "" && ns != "default" {
+				if err := EnsureNamespace(ctx, a.client, ns); err != nil {
+					return err
+				}
+			}
+		} else {
+			// for cluster-wide resources
+			dr = a.dyn.Resource(mapping.Resource)
+		}
+
+		// Get what's there now to tell what the patch did
+		if withResult {
+			live, err = dr.Get(ctx, obj.GetName(), v1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				live = nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		out, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, patchOpts)
+		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ApplyResult{
+		GVK:       *gvk,
+		Namespace: out.GetNamespace(),
+		Name:      out.GetName(),
+		DryRun:    opts.DryRun,
+		Object:    out,
+	}
+	if withResult {
+		res.Operation = operationFor(live, out, opts.DryRun)
+	}
+	a.log().Debug("object applied", "gvk", gvk.String(), "namespace", res.Namespace, "name", res.Name,
+		"attempt", attempt, "operation", string(res.Operation), "dryRun", opts.DryRun)
+	return res, nil
+}
+
+// isRetriableApplyError checks to see if the error is one that goes away once the cluster settles.
+// A field manager conflict never does, someone else owns the fields until Force is used
+func isRetriableApplyError(err error) bool {
+	if apierrors.HasStatusCause(err, v1.CauseTypeFieldManagerConflict) {
+		return false
+	}
+	return apierrors.IsConflict(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		meta.IsNoMatchError(err)
+}
+
+// operationFor compares the live object with the one returned by the patch
+func operationFor(live, out *unstructured.Unstructured, dryRun bool) Operation {
+	if live == nil {
+		return OperationCreated
+	}
+
+	// A real write bumps the resourceVersion
+	if !dryRun {
+		if live.GetResourceVersion() == out.GetResourceVersion() {
+			return OperationUnchanged
+		}
+		return OperationConfigured
+	}
+
+	// Nothing gets written on a dry-run, so compare the objects themselves
+	before, after := live.DeepCopy(), out.DeepCopy()
+	for _, o := range []*unstructured.Unstructured{before, after} {
+		o.SetManagedFields(nil)
+		o.SetResourceVersion("")
+	}
+	if reflect.DeepEqual(before.Object, after.Object) {
+		return OperationUnchanged
+	}
+	return OperationConfigured
+}
+
+// DoSSA  does service side apply with the given YAML as a []byte
+func DoSSA(ctx context.Context, cfg *rest.Config, yaml []byte) error {
+	a, err := NewApplier(cfg)
+	if err != nil {
+		return err
+	}
+	return a.Apply(ctx, yaml)
+}
 
+// DoSSADryRun does a service side apply dry-run and returns the object the server would produce
+func DoSSADryRun(ctx context.Context, cfg *rest.Config, yaml []byte) (*unstructured.Unstructured, error) {
+	a, err := NewApplier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return a.ApplyDryRun(ctx, yaml)
+}
+
+// EnsureNamespace creates the named namespace if it doesn't exist. It's a no-op if it's already there
+func EnsureNamespace(ctx context.Context, c kubernetes.Interface, name string) error {
+	_, err := c.CoreV1().Namespaces().Get(ctx, name, v1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, err = c.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+	}, v1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
 	return err
 }
 
+// DoSSAWithResult does service side apply with the given YAML and reports what happened to the object
+func DoSSAWithResult(ctx context.Context, cfg *rest.Config, yaml []byte, opts SSAOptions) (*ApplyResult, error) {
+	a, err := NewApplier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return a.ApplyWithResult(ctx, yaml, opts)
+}
+
 //check to see if the named deployment is running
 func IsDeploymentRunning(c kubernetes.Interface, ns string, depl string) wait.ConditionFunc {
 
@@ -135,24 +427,281 @@ func IsDeploymentRunning(c kubernetes.Interface, ns string, depl string) wait.Co
 
 // Poll up to timeout seconds for pod to enter running state.
 func WaitForDeployment(c kubernetes.Interface, namespace string, deployment string, timeout time.Duration) error {
-	return wait.PollImmediate(5*time.Second, timeout, IsDeploymentRunning(c, namespace, deployment))
+	return waitFor("Deployment", namespace, deployment, timeout, IsDeploymentRunning(c, namespace, deployment))
 }
 
-// NewClient returns a kubernetes.Interface
-func NewClient(kubeConfigPath string) (kubernetes.Interface, error) {
+// IsDaemonSetRunning checks to see if the named daemonset has a ready pod on every node it's scheduled on
+func IsDaemonSetRunning(c kubernetes.Interface, ns string, ds string) wait.ConditionFunc {
+
+	return func() (bool, error) {
+
+		// Get the named daemonset
+		d, err := c.AppsV1().DaemonSets(ns).Get(context.TODO(), ds, v1.GetOptions{})
+
+		// If the daemonset is not found, that's okay. It means it's not up and running yet
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		// if another error was found, return that
+		if err != nil {
+			return false, err
+		}
+
+		// The controller hasn't caught up with the latest spec yet
+		if d.Status.ObservedGeneration < d.Generation {
+			return false, nil
+		}
+
+		// If the rollout hasn't finished, then let's run again. A daemonset that matches no
+		// nodes wants no pods, so it's done, like kubectl rollout status says
+		if d.Status.NumberReady != d.Status.DesiredNumberScheduled ||
+			d.Status.UpdatedNumberScheduled != d.Status.DesiredNumberScheduled {
+			return false, nil
+		}
+
+		return true, nil
+
+	}
+}
+
+// IsStatefulSetRunning checks to see if all replicas of the named statefulset are ready and updated
+func IsStatefulSetRunning(c kubernetes.Interface, ns string, sts string) wait.ConditionFunc {
+
+	return func() (bool, error) {
+
+		// Get the named statefulset
+		s, err := c.AppsV1().StatefulSets(ns).Get(context.TODO(), sts, v1.GetOptions{})
+
+		// If the statefulset is not found, that's okay. It means it's not up and running yet
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		// if another error was found, return that
+		if err != nil {
+			return false, err
+		}
+
+		// The controller hasn't caught up with the latest spec yet
+		if s.Status.ObservedGeneration < s.Generation {
+			return false, nil
+		}
+
+		// Replicas defaults to 1 when not set
+		replicas := int32(1)
+		if s.Spec.Replicas != nil {
+			replicas = *s.Spec.Replicas
+		}
+
+		// If the rollout hasn't finished, then let's run again
+		if s.Status.ReadyReplicas != replicas || s.Status.UpdatedReplicas != replicas {
+			return false, nil
+		}
+		if s.Status.UpdateRevision != "" && s.Status.CurrentRevision != s.Status.UpdateRevision {
+			return false, nil
+		}
+
+		return true, nil
+
+	}
+}
+
+// Poll up to timeout seconds for the daemonset to be ready on all nodes.
+func WaitForDaemonSet(c kubernetes.Interface, namespace string, daemonset string, timeout time.Duration) error {
+	return waitFor("DaemonSet", namespace, daemonset, timeout, IsDaemonSetRunning(c, namespace, daemonset))
+}
+
+// Poll up to timeout seconds for the statefulset to be ready.
+func WaitForStatefulSet(c kubernetes.Interface, namespace string, statefulset string, timeout time.Duration) error {
+	return waitFor("StatefulSet", namespace, statefulset, timeout, IsStatefulSetRunning(c, namespace, statefulset))
+}
+
+// IsNodeReady checks to see if the named node's Ready condition matches ready
+func IsNodeReady(c kubernetes.Interface, node string, ready bool) wait.ConditionFunc {
+
+	return func() (bool, error) {
+
+		// Get the named node
+		n, err := c.CoreV1().Nodes().Get(context.TODO(), node, v1.GetOptions{})
+
+		// If the node is not found, that's okay. It means it hasn't joined yet
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		// if another error was found, return that
+		if err != nil {
+			return false, err
+		}
+
+		for _, cond := range n.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				return (cond.Status == corev1.ConditionTrue) == ready, nil
+			}
+		}
+
+		// No Ready condition yet means it isn't ready
+		return !ready, nil
+
+	}
+}
+
+// Poll up to timeout seconds for the node to become Ready.
+func WaitForNodeReady(c kubernetes.Interface, node string, timeout time.Duration) error {
+	return waitFor("Node", "", node, timeout, IsNodeReady(c, node, true))
+}
+
+// Poll up to timeout seconds for the node to become NotReady.
+func WaitForNodeNotReady(c kubernetes.Interface, node string, timeout time.Duration) error {
+	return waitFor("Node", "", node, timeout, IsNodeReady(c, node, false))
+}
+
+// IsEndpointReady checks to see if the named service has at least one ready endpoint address
+func IsEndpointReady(c kubernetes.Interface, ns string, service string) wait.ConditionFunc {
+
+	return func() (bool, error) {
+
+		// Get the EndpointSlices of the service
+		slices, err := c.DiscoveryV1().EndpointSlices(ns).List(context.TODO(), v1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+		})
+
+		// if another error was found, return that
+		if err != nil {
+			return false, err
+		}
+
+		for _, s := range slices.Items {
+			for _, e := range s.Endpoints {
+				// A nil Ready should be taken as ready
+				if len(e.Addresses) != 0 && (e.Conditions.Ready == nil || *e.Conditions.Ready) {
+					return true, nil
+				}
+			}
+		}
+
+		// Nothing ready yet, so let's run again
+		return false, nil
+
+	}
+}
+
+// Poll up to timeout seconds for the service to have a ready endpoint.
+func WaitForEndpointReady(c kubernetes.Interface, namespace string, service string, timeout time.Duration) error {
+	return waitFor("Service", namespace, service, timeout, IsEndpointReady(c, namespace, service))
+}
+
+// IsPodReady checks to see if the named pod is ready
+func IsPodReady(c kubernetes.Interface, ns string, pod string) wait.ConditionFunc {
+
+	return func() (bool, error) {
+
+		// Get the pod
+		p, err := c.CoreV1().Pods(ns).Get(context.TODO(), pod, v1.GetOptions{})
+
+		// if the pod isn't there yet, let's run again
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		// if another error was found, return that
+		if err != nil {
+			return false, err
+		}
+
+		return isPodReady(p), nil
+
+	}
+}
+
+// WaitForPod waits up to timeout for the named pod to be ready
+func WaitForPod(c kubernetes.Interface, namespace string, pod string, timeout time.Duration) error {
+	return waitFor("Pod", namespace, pod, timeout, IsPodReady(c, namespace, pod))
+}
+
+// waitFor polls the condition every 5 seconds up to timeout, logging progress as it goes
+func waitFor(kind string, namespace string, name string, timeout time.Duration, condition wait.ConditionFunc) error {
+	start := time.Now()
+	return wait.PollImmediate(5*time.Second, timeout, func() (bool, error) {
+		done, err := condition()
+		if err == nil {
+			elapsed := time.Since(start).Round(time.Second).String()
+			if done {
+				GetLogger().Debug("wait finished", "kind", kind, "namespace", namespace, "name", name, "elapsed", elapsed)
+			} else {
+				GetLogger().Debug("still waiting", "kind", kind, "namespace", namespace, "name", name, "elapsed", elapsed)
+			}
+		}
+		return done, err
+	})
+}
+
+// WaitForWorkload waits for a Deployment, DaemonSet or StatefulSet depending on the kind given
+func WaitForWorkload(c kubernetes.Interface, kind string, namespace string, name string, timeout time.Duration) error {
+	switch strings.ToLower(kind) {
+	case "deployment", "deploy":
+		return WaitForDeployment(c, namespace, name, timeout)
+	case "daemonset", "ds":
+		return WaitForDaemonSet(c, namespace, name, timeout)
+	case "statefulset", "sts":
+		return WaitForStatefulSet(c, namespace, name, timeout)
+	default:
+		return fmt.Errorf("unsupported workload kind %q", kind)
+	}
+}
+
+// NewConfig returns a *rest.Config for the given kubeconfig path. If no path
+// is given, it falls back to $KUBECONFIG and then to ~/.kube/config. If neither
+// was set and ~/.kube/config doesn't exist, the in-cluster config is used.
+func NewConfig(kubeConfigPath string) (*rest.Config, error) {
 	if kubeConfigPath == "" {
 		kubeConfigPath = os.Getenv("KUBECONFIG")
 	}
 	if kubeConfigPath == "" {
 		kubeConfigPath = clientcmd.RecommendedHomeFile // use default path(.kube/config)
+
+		// If there's no default kubeconfig either, we might be running inside a cluster.
+		// A path that was asked for explicitly never falls back, so a typo is an error
+		if _, err := os.Stat(kubeConfigPath); os.IsNotExist(err) {
+			if cfg, err := rest.InClusterConfig(); err == nil {
+				return cfg, nil
+			}
+		}
 	}
-	kubeConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+
+	return clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+}
+
+// NewClient returns a kubernetes.Interface
+func NewClient(kubeConfigPath string) (kubernetes.Interface, error) {
+	kubeConfig, err := NewConfig(kubeConfigPath)
 	if err != nil {
 		return nil, err
 	}
 	return kubernetes.NewForConfig(kubeConfig)
 }
 
+// NewClients returns the typed client, the dynamic client and the *rest.Config they were built from
+func NewClients(kubeConfigPath string) (kubernetes.Interface, dynamic.Interface, *rest.Config, error) {
+	kubeConfig, err := NewConfig(kubeConfigPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dyn, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return c, dyn, kubeConfig, nil
+}
+
 // DownloadFileString will load the contents of a url to a string and return it
 func DownloadFileString(url string) (string, error) {
 	// Get the data
@@ -170,26 +719,134 @@ func DownloadFileString(url string) (string, error) {
 
 // SplitYAML splits a multipart YAML and returns a slice of a slice of byte
 func SplitYAML(resources []byte) ([][]byte, error) {
+	return SplitYAMLReader(bytes.NewReader(resources))
+}
 
-	dec := goyaml.NewDecoder(bytes.NewReader(resources))
+// SplitYAMLReader splits a multipart YAML on its document boundaries. Each document
+// is returned with its original bytes, and documents that are only whitespace or
+// comments are dropped
+func SplitYAMLReader(r io.Reader) ([][]byte, error) {
+	docs, err := splitYAMLDocuments(r)
+	if err != nil {
+		return nil, err
+	}
 
 	var res [][]byte
+	for _, d := range docs {
+		res = append(res, d.doc)
+	}
+	return res, nil
+}
+
+// yamlDocument is a document from a multipart YAML and its position in it
+type yamlDocument struct {
+	index int
+	doc   []byte
+}
+
+// splitYAMLDocuments does the splitting for SplitYAMLReader. Blank documents are dropped,
+// but still count towards the index so it matches the position in the source
+func splitYAMLDocuments(r io.Reader) ([]yamlDocument, error) {
+	br := bufio.NewReader(r)
+
+	var res []yamlDocument
+	var buf bytes.Buffer
+	index := 0
+	// explicit is set when the current document was started with a "---"
+	explicit := false
+	flush := func() {
+		blank := isBlankDocument(buf.Bytes())
+		if !blank {
+			doc := make([]byte, buf.Len())
+			copy(doc, buf.Bytes())
+			res = append(res, yamlDocument{index: index, doc: doc})
+		}
+		// Comments before the first "---" (or after a "...") aren't a document of their own
+		if !blank || explicit {
+			index++
+		}
+		buf.Reset()
+	}
+
 	for {
-		var value interface{}
-		err := dec.Decode(&value)
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if len(line) > 0 {
+			switch marker, rest := documentMarker(line); {
+			case marker == "...":
+				// End of the document, the marker itself isn't part of it
+				flush()
+				explicit = false
+			case marker == "---" && hasOnlyDirectives(buf.Bytes()):
+				// Directives like %YAML belong to the document that follows
+				buf.Write(line)
+				explicit = true
+			case marker == "---":
+				flush()
+				explicit = true
+				// Content can start on the same line, like "--- |"
+				if rest != "" && !strings.HasPrefix(rest, "#") {
+					buf.Write(line)
+				}
+			default:
+				buf.Write(line)
+			}
+		}
+
 		if err == io.EOF {
-			break
+			flush()
+			return res, nil
 		}
-		if err != nil {
-			return nil, err
+	}
+}
+
+// documentMarker returns "---" or "..." if the line starts with a document marker
+// (only at column 0) along with whatever else is on the line
+func documentMarker(line []byte) (string, string) {
+	l := string(bytes.TrimRight(line, "\r\n"))
+	for _, m := range []string{"---", "..."} {
+		if !strings.HasPrefix(l, m) {
+			continue
 		}
-		valueBytes, err := goyaml.Marshal(value)
-		if err != nil {
-			return nil, err
+		rest := l[len(m):]
+		if rest == "" {
+			return m, ""
+		}
+		if rest[0] == ' ' || rest[0] == '\t' {
+			return m, strings.TrimSpace(rest)
 		}
-		res = append(res, valueBytes)
 	}
-	return res, nil
+	return "", ""
+}
+
+// isBlankDocument checks to see if the document has nothing but whitespace and comments
+func isBlankDocument(doc []byte) bool {
+	for _, l := range strings.Split(string(doc), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// hasOnlyDirectives checks to see if the document so far is only %-directives (and comments)
+func hasOnlyDirectives(doc []byte) bool {
+	found := false
+	for _, l := range strings.Split(string(doc), "\n") {
+		l = strings.TrimSpace(l)
+		switch {
+		case l == "", strings.HasPrefix(l, "#"):
+		case strings.HasPrefix(l, "%"):
+			found = true
+		default:
+			return false
+		}
+	}
+	return found
 }
 
 // LabelWorkers will label the workers nodes as such
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSplitYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "anchors and aliases",
+			input: "base: &base\n  image: nginx\n---\nderived:\n  <<: *base\n  port: 80\n",
+			want:  []string{"base: &base\n  image: nginx\n", "derived:\n  <<: *base\n  port: 80\n"},
+		},
+		{
+			name:  "marker inside block scalar",
+			input: "data:\n  script: |\n    ---\n    echo hi\n---\nb: 2\n",
+			want:  []string{"data:\n  script: |\n    ---\n    echo hi\n", "b: 2\n"},
+		},
+		{
+			name:  "trailing document without newline",
+			input: "a: 1\n---\nb: 2",
+			want:  []string{"a: 1\n", "b: 2"},
+		},
+		{
+			name:  "preserves bytes",
+			input: "# leading comment\nz: 1   # trailing comment\na:   \"quoted\"\n\nm: [1,2]\n",
+			want:  []string{"# leading comment\nz: 1   # trailing comment\na:   \"quoted\"\n\nm: [1,2]\n"},
+		},
+		{
+			name:  "drops comment-only documents",
+			input: "a: 1\n---\n# nothing here\n\n---\n---\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "directives stay with their document",
+			input: "%YAML 1.1\n---\na: 1\n---\nb: 2\n",
+			want:  []string{"%YAML 1.1\n---\na: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "content on the marker line",
+			input: "a: 1\n--- |\n  some text\n",
+			want:  []string{"a: 1\n", "--- |\n  some text\n"},
+		},
+		{
+			name:  "comment on the marker line",
+			input: "--- # first\na: 1\n--- # second\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "document end marker",
+			input: "a: 1\n...\n---\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "CRLF",
+			input: "a: 1\r\n---\r\nb: 2\r\n",
+			want:  []string{"a: 1\r\n", "b: 2\r\n"},
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := SplitYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, d := range docs {
+				got = append(got, string(d))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitYAML(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetriableApplyError(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "field manager conflict",
+			err: apierrors.NewApplyConflict([]v1.StatusCause{{
+				Type:    v1.CauseTypeFieldManagerConflict,
+				Message: `conflict with "kubectl"`,
+				Field:   ".spec.replicas",
+			}}, "Apply failed with 1 conflict"),
+			want: false,
+		},
+		{name: "conflict", err: apierrors.NewConflict(gr, "test", errors.New("try again")), want: true},
+		{name: "server timeout", err: apierrors.NewServerTimeout(gr, "patch", 1), want: true},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("not ready"), want: true},
+		{name: "no match", err: &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "example.com", Kind: "Widget"}}, want: true},
+		{name: "invalid", err: apierrors.NewBadRequest("bad"), want: false},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "test", errors.New("no")), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetriableApplyError(tt.err); got != tt.want {
+				t.Errorf("isRetriableApplyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDaemonSetRunning(t *testing.T) {
+	tests := []struct {
+		name   string
+		status appsv1.DaemonSetStatus
+		want   bool
+	}{
+		{
+			name:   "all ready",
+			status: appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 3},
+			want:   true,
+		},
+		{
+			name:   "matches no nodes",
+			status: appsv1.DaemonSetStatus{ObservedGeneration: 2},
+			want:   true,
+		},
+		{
+			name:   "not observed yet",
+			status: appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 3},
+			want:   false,
+		},
+		{
+			name:   "not all ready",
+			status: appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, NumberReady: 2, UpdatedNumberScheduled: 3},
+			want:   false,
+		},
+		{
+			name:   "not all updated",
+			status: appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, NumberReady: 3, UpdatedNumberScheduled: 1},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewSimpleClientset(&appsv1.DaemonSet{
+				ObjectMeta: v1.ObjectMeta{Name: "ds", Namespace: "ns", Generation: 2},
+				Status:     tt.status,
+			})
+			got, err := IsDaemonSetRunning(c, "ns", "ds")()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsDaemonSetRunning = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Not created yet isn't an error
+	got, err := IsDaemonSetRunning(fake.NewSimpleClientset(), "ns", "ds")()
+	if err != nil || got {
+		t.Errorf("IsDaemonSetRunning of a missing daemonset = %v, %v, want false, nil", got, err)
+	}
+}